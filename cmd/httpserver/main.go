@@ -1,60 +1,76 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
+	"github.com/mogumogu934/learnhttpfromtcp/internal/fileserver"
 	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/middleware"
 	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
 	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/router"
 	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
 )
 
-const port = 42069
+const (
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
+	uploadMaxMemory = 1024 * 1024
+)
 
 func main() {
+	assets := fileserver.Dir("assets")
+	assets.Listing = true
+
+	rt := router.New()
+	rt.Mount("/httpbin", proxyHandler)
+	rt.Mount("/video", videoHandler)
+	rt.Mount("/assets", assets.ServeHTTP)
+	rt.Handle("/yourproblem", handler400)
+	rt.Handle("/myproblem", handler500)
+	rt.Handle("GET /upload", uploadFormHandler)
+	rt.Handle("POST /upload", uploadHandler)
+	rt.Mount("/", handler200)
+
+	handler := middleware.Chain(
+		middleware.RequestID,
+		middleware.Logger,
+		middleware.Recover,
+		middleware.Timing,
+		middleware.Compress,
+	)(rt.ServeHTTP)
+
 	server, err := server.Serve(port, handler)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		proxyHandler(w, req)
-		return
-	}
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/video") {
-		videoHandler(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		handler400(w, req)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to stop: %v", err)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
-		handler500(w, req)
-		return
-	}
-	handler200(w, req)
-	return
+	log.Println("Server gracefully stopped")
 }
 
 func handler400(w *response.Writer, _ *request.Request) {
+	w.Header().Set("Content-Type", "text/html")
 	w.WriteStatusLine(response.StatusCodeBadRequest)
 	body := []byte(`<html>
 <head>
@@ -66,14 +82,11 @@ func handler400(w *response.Writer, _ *request.Request) {
 </body>
 </html>
 `)
-	h := response.GetDefaultHeaders(len(body))
-	h.Overwrite("Content-Type", "text/html")
-	w.WriteHeaders(h)
-	w.WriteBody(body)
-	return
+	w.Write(body)
 }
 
 func handler500(w *response.Writer, _ *request.Request) {
+	w.Header().Set("Content-Type", "text/html")
 	w.WriteStatusLine(response.StatusCodeInternalServerError)
 	body := []byte(`<html>
 <head>
@@ -85,15 +98,10 @@ func handler500(w *response.Writer, _ *request.Request) {
 </body>
 </html>
 `)
-	h := response.GetDefaultHeaders(len(body))
-	h.Overwrite("Content-Type", "text/html")
-	w.WriteHeaders(h)
-	w.WriteBody(body)
-	return
+	w.Write(body)
 }
 
-func handler200(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusCodeOK)
+func handler200(w *response.Writer, req *request.Request) {
 	body := []byte(`<html>
 <head>
 <title>200 OK</title>
@@ -104,15 +112,78 @@ func handler200(w *response.Writer, _ *request.Request) {
 </body>
 </html>
 `)
-	h := response.GetDefaultHeaders(len(body))
-	h.Overwrite("Content-Type", "text/html")
-	w.WriteHeaders(h)
-	w.WriteBody(body)
-	return
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("ETag", response.ETag(fmt.Sprintf("%x", sha256.Sum256(body)), false))
+	if response.CheckPreconditions(w, req) {
+		return
+	}
+	w.WriteStatusLine(response.StatusCodeOK)
+	w.Write(body)
+}
+
+func uploadFormHandler(w *response.Writer, _ *request.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(`<html>
+<head>
+<title>Upload</title>
+</head>
+<body>
+<h1>Upload</h1>
+<form method="post" action="/upload" enctype="multipart/form-data">
+<p><input type="text" name="description" placeholder="Description"></p>
+<p><input type="file" name="files" multiple></p>
+<p><input type="submit" value="Upload"></p>
+</form>
+</body>
+</html>
+`))
+}
+
+func uploadHandler(w *response.Writer, req *request.Request) {
+	err := req.ParseMultipartForm(uploadMaxMemory)
+	if err != nil {
+		log.Println("unable to parse upload:", err)
+		handler400(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html>
+<head>
+<title>Uploaded</title>
+</head>
+<body>
+<h1>Uploaded</h1>
+<p>%s</p>
+<ul>
+`, html.EscapeString(req.FormValue("description")))
+	for _, fh := range req.MultipartForm.File["files"] {
+		f, err := fh.Open()
+		if err != nil {
+			log.Println("unable to open uploaded file:", err)
+			continue
+		}
+		sum := sha256.New()
+		_, err = io.Copy(sum, f)
+		f.Close()
+		if err != nil {
+			log.Println("unable to read uploaded file:", err)
+			continue
+		}
+		fmt.Fprintf(w, "<li>%s (%d bytes, sha256 %x)</li>\n", html.EscapeString(fh.Filename), fh.Size, sum.Sum(nil))
+	}
+	w.Write([]byte(`</ul>
+<p><a href="/upload">Upload more</a></p>
+</body>
+</html>
+`))
 }
 
 func proxyHandler(w *response.Writer, req *request.Request) {
-	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
+	target := req.PathValue("*")
+	if req.Target.RawQuery != "" {
+		target += "?" + req.Target.RawQuery
+	}
 	url := "https://httpbin.org/" + target
 	resp, err := http.Get(url)
 	if err != nil {
@@ -123,7 +194,7 @@ func proxyHandler(w *response.Writer, req *request.Request) {
 
 	w.WriteStatusLine(response.StatusCodeOK)
 	h := response.GetDefaultHeaders(0)
-	delete(h, "Content-Length")
+	h.Del("Content-Length")
 	h.Overwrite("Transfer-Encoding", "chunked")
 	h.Overwrite("Trailer", "X-Content-SHA256, X-Content-Length")
 	w.WriteHeaders(h)
@@ -140,6 +211,11 @@ func proxyHandler(w *response.Writer, req *request.Request) {
 				log.Println("unable to write chunked body:", err)
 				break
 			}
+			err = w.Flush()
+			if err != nil {
+				log.Println("unable to flush chunked body:", err)
+				break
+			}
 			fullBody = append(fullBody, buf[:n]...)
 		}
 
@@ -167,18 +243,6 @@ func proxyHandler(w *response.Writer, req *request.Request) {
 	}
 }
 
-func videoHandler(w *response.Writer, _ *request.Request) {
-	h := response.GetDefaultHeaders(0)
-	h.Overwrite("Content-Type", "video/mp4")
-	f, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		log.Println("unable to read contents from video:", err)
-		return
-	}
-	h.Overwrite("Content-Length", fmt.Sprintf("%d", len(f)))
-
-	w.WriteStatusLine(response.StatusCodeOK)
-	w.WriteHeaders(h)
-	w.WriteBody(f)
-	return
+func videoHandler(w *response.Writer, req *request.Request) {
+	fileserver.ServeFile(w, req, "assets/vim.mp4")
 }
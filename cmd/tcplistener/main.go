@@ -33,7 +33,7 @@ func main() {
 		fmt.Printf("- Target: %s\n", req.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", req.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for k, v := range req.Headers {
+		for k, v := range req.Headers.All() {
 			fmt.Printf("- %s: %s\n", k, v)
 		}
 		fmt.Println("Body:")
@@ -0,0 +1,281 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/router"
+)
+
+const (
+	indexPage      = "index.html"
+	sniffLen       = 512
+	allowedMethods = "GET, HEAD"
+)
+
+type FileServer struct {
+	fsys fs.FS
+	// Listing renders an HTML listing for directories without an index.html
+	// instead of answering 404.
+	Listing bool
+}
+
+// New returns a FileServer for fsys. When mounted on a router, the part of the
+// path matched by the mount wildcard is looked up in fsys; otherwise the whole
+// request path is.
+func New(fsys fs.FS) *FileServer {
+	return &FileServer{fsys: fsys}
+}
+
+// Dir returns a FileServer for the directory tree rooted at root.
+func Dir(root string) *FileServer {
+	return New(os.DirFS(root))
+}
+
+func (fsrv *FileServer) ServeHTTP(w *response.Writer, req *request.Request) {
+	name, ok := req.LookupPathValue(router.MountPathValue)
+	if !ok {
+		name = req.Target.Path
+	}
+	serve(w, req, fsrv.fsys, name, fsrv.Listing)
+}
+
+// ServeFile serves the file or directory at name from the local file system.
+// A directory is served through its index.html, if it has one.
+func ServeFile(w *response.Writer, req *request.Request, name string) {
+	dir, file := filepath.Split(filepath.Clean(name))
+	if dir == "" {
+		dir = "."
+	}
+	serve(w, req, os.DirFS(dir), file, false)
+}
+
+// ServeContent streams content as the response body, with a Content-Type
+// taken from the extension of name or, failing that, sniffed from the first
+// bytes of content. A non-zero modtime is sent as Last-Modified. Conditional
+// requests are checked against it and any ETag already set in w.Header(), and
+// Range requests are answered with the requested parts of content.
+func ServeContent(w *response.Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	if !checkMethod(w, req) {
+		return
+	}
+
+	h := w.Header()
+	if !modtime.IsZero() && modtime.Unix() != 0 {
+		h.Overwrite("Last-Modified", modtime.UTC().Format(response.TimeFormat))
+	}
+	h.Overwrite("Accept-Ranges", "bytes")
+	if response.CheckPreconditions(w, req) {
+		return
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		writeError(w, response.StatusCodeInternalServerError, "unable to seek content")
+		return
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		writeError(w, response.StatusCodeInternalServerError, "unable to seek content")
+		return
+	}
+
+	contentType, err := detectContentType(name, content)
+	if err != nil {
+		writeError(w, response.StatusCodeInternalServerError, "unable to read content")
+		return
+	}
+	h.Overwrite("Content-Type", contentType)
+	if serveRanges(w, req, name, contentType, size, content) {
+		return
+	}
+
+	h.Overwrite("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteStatusLine(response.StatusCodeOK)
+	w.WriteHeaders(h)
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	_, err = io.CopyN(w, content, size)
+	if err != nil {
+		logSendError(name, err)
+	}
+}
+
+func logSendError(name string, err error) {
+	log.Printf("unable to send %s: %v", name, err)
+}
+
+func serve(w *response.Writer, req *request.Request, fsys fs.FS, name string, listing bool) {
+	if !checkMethod(w, req) {
+		return
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(req.Target.Path, "/") {
+			// Relative links in the index or listing need the trailing slash.
+			redirect(w, req, req.Target.RawPath+"/")
+			return
+		}
+		index, err := fsys.Open(path.Join(name, indexPage))
+		if err == nil {
+			defer index.Close()
+			indexInfo, err := index.Stat()
+			if err == nil && !indexInfo.IsDir() {
+				serveFile(w, req, index, indexInfo)
+				return
+			}
+		}
+		if !listing {
+			writeError(w, response.StatusCodeNotFound, "404 page not found\n")
+			return
+		}
+		serveListing(w, req, f)
+		return
+	}
+
+	serveFile(w, req, f, info)
+}
+
+func serveFile(w *response.Writer, req *request.Request, f fs.File, info fs.FileInfo) {
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// Not every fs.FS hands out seekable files; those are read into memory.
+		b, err := io.ReadAll(f)
+		if err != nil {
+			writeError(w, response.StatusCodeInternalServerError, "unable to read file")
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fileETag(info))
+	}
+	ServeContent(w, req, info.Name(), info.ModTime(), content)
+}
+
+// fileETag derives a strong ETag from the modification time and size, which
+// change whenever the file is rewritten.
+func fileETag(info fs.FileInfo) string {
+	return response.ETag(fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()), false)
+}
+
+func serveListing(w *response.Writer, req *request.Request, f fs.File) {
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		writeError(w, response.StatusCodeInternalServerError, "unable to read directory")
+		return
+	}
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		writeError(w, response.StatusCodeInternalServerError, "unable to read directory")
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	title := html.EscapeString(req.Target.Path)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html>\n<head>\n<title>Index of %s</title>\n</head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		href := (&url.URL{Path: name}).EscapedPath()
+		fmt.Fprintf(w, "<li><a href=\"./%s\">%s</a></li>\n", href, html.EscapeString(name))
+	}
+	w.Write([]byte("</ul>\n</body>\n</html>\n"))
+}
+
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType != "" {
+		return contentType, nil
+	}
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func checkMethod(w *response.Writer, req *request.Request) bool {
+	switch req.RequestLine.Method {
+	case "GET", "HEAD":
+		return true
+	}
+	w.Header().Set("Allow", allowedMethods)
+	writeError(w, response.StatusCodeMethodNotAllowed, "405 method not allowed\n")
+	return false
+}
+
+func redirect(w *response.Writer, req *request.Request, location string) {
+	if req.Target.RawQuery != "" {
+		location += "?" + req.Target.RawQuery
+	}
+	w.Header().Set("Location", location)
+	writeError(w, response.StatusCodeMovedPermanently, "")
+}
+
+func writeFSError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, response.StatusCodeNotFound, "404 page not found\n")
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, response.StatusCodeForbidden, "403 forbidden\n")
+	case errors.Is(err, fs.ErrInvalid):
+		writeError(w, response.StatusCodeBadRequest, "400 bad request\n")
+	default:
+		writeError(w, response.StatusCodeInternalServerError, "500 internal server error\n")
+	}
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+	body := []byte(message)
+	h := w.Header()
+	h.Overwrite("Content-Type", "text/plain")
+	h.Overwrite("Content-Length", strconv.Itoa(len(body)))
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
@@ -0,0 +1,169 @@
+package fileserver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/router"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+var testFS = fstest.MapFS{
+	"hello.txt":          {Data: []byte("hello world"), ModTime: modTime},
+	"page.html":          {Data: []byte("<html>page</html>")},
+	"noext":              {Data: []byte("%PDF-1.4 not really")},
+	"docs/index.html":    {Data: []byte("<html>docs</html>")},
+	"files/b & c.txt":    {Data: []byte("b")},
+	"files/a.txt":        {Data: []byte("a")},
+	"files/sub/deep.txt": {Data: []byte("deep")},
+}
+
+func serveReq(t *testing.T, h server.Handler, rawReq string) string {
+	req, err := request.RequestFromReader(strings.NewReader(rawReq))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequest(req)
+	h(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func get(t *testing.T, h server.Handler, method, target string) string {
+	return serveReq(t, h, method+" "+target+" HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+}
+
+func TestFileServer(t *testing.T) {
+	fsrv := New(testFS)
+	rt := router.New()
+	rt.Mount("/static", fsrv.ServeHTTP)
+
+	// Test: File with Content-Type from its extension
+	resp := get(t, rt.ServeHTTP, "GET", "/static/hello.txt")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, resp, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, resp, "Content-Length: 11\r\n")
+	assert.Contains(t, resp, "Last-Modified: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello world"))
+
+	// Test: Content-Type sniffed without an extension
+	resp = get(t, rt.ServeHTTP, "GET", "/static/noext")
+	assert.Contains(t, resp, "Content-Type: application/pdf\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n%PDF-1.4 not really"))
+
+	// Test: HEAD sends headers only
+	resp = get(t, rt.ServeHTTP, "HEAD", "/static/hello.txt")
+	assert.Contains(t, resp, "Content-Length: 11\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Directory index
+	resp = get(t, rt.ServeHTTP, "GET", "/static/docs/")
+	assert.Contains(t, resp, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.True(t, strings.HasSuffix(resp, "<html>docs</html>"))
+
+	// Test: Directory without trailing slash is redirected
+	resp = get(t, rt.ServeHTTP, "GET", "/static/docs?x=1")
+	assert.Contains(t, resp, "HTTP/1.1 301 Moved Permanently\r\n")
+	assert.Contains(t, resp, "Location: /static/docs/?x=1\r\n")
+
+	// Test: Directory without index and listing disabled
+	resp = get(t, rt.ServeHTTP, "GET", "/static/files/")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Missing file and escaping the root
+	resp = get(t, rt.ServeHTTP, "GET", "/static/missing.txt")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n")
+	resp = get(t, rt.ServeHTTP, "GET", "/static/../../etc/passwd")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n")
+	resp = get(t, rt.ServeHTTP, "GET", "/static/%2e%2e/hello.txt")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+
+	// Test: Other methods
+	resp = get(t, rt.ServeHTTP, "POST", "/static/hello.txt")
+	assert.Contains(t, resp, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, resp, "Allow: GET, HEAD\r\n")
+
+	// Test: Directory listing
+	fsrv.Listing = true
+	resp = get(t, rt.ServeHTTP, "GET", "/static/files/")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, resp, "<title>Index of /static/files/</title>")
+	assert.Contains(t, resp, "<li><a href=\"./a.txt\">a.txt</a></li>\n<li><a href=\"./b%20&%20c.txt\">b &amp; c.txt</a></li>\n<li><a href=\"./sub/\">sub/</a></li>\n")
+
+	// Test: Without a router the whole request path is used
+	resp = get(t, fsrv.ServeHTTP, "GET", "/files/sub/deep.txt")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\ndeep"))
+	resp = get(t, fsrv.ServeHTTP, "GET", "/docs/")
+	assert.True(t, strings.HasSuffix(resp, "<html>docs</html>"))
+	resp = get(t, fsrv.ServeHTTP, "GET", "/missing.txt")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n")
+}
+
+func TestServeFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("not a video"), 0o644))
+
+	// Test: Single file regardless of the request path
+	h := func(w *response.Writer, req *request.Request) {
+		ServeFile(w, req, filepath.Join(dir, "clip.mp4"))
+	}
+	resp := get(t, h, "GET", "/video/anything")
+	assert.Contains(t, resp, "Content-Type: video/mp4\r\n")
+	assert.Contains(t, resp, "Content-Length: 11\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nnot a video"))
+
+	// Test: Missing file
+	h = func(w *response.Writer, req *request.Request) {
+		ServeFile(w, req, filepath.Join(dir, "missing.mp4"))
+	}
+	resp = get(t, h, "GET", "/video")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n")
+}
+
+func TestConditionalRequests(t *testing.T) {
+	rt := router.New()
+	rt.Mount("/static", New(testFS).ServeHTTP)
+	etag := response.ETag(fmt.Sprintf("%x-%x", modTime.UnixNano(), 11), false)
+	conditional := func(method, conditions string) string {
+		return serveReq(t, rt.ServeHTTP, method+" /static/hello.txt HTTP/1.1\r\nHost: localhost:42069\r\n"+conditions+"\r\n")
+	}
+
+	// Test: Validators are sent
+	resp := get(t, rt.ServeHTTP, "GET", "/static/hello.txt")
+	assert.Contains(t, resp, "Etag: "+etag+"\r\n")
+	assert.Contains(t, resp, "Last-Modified: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+
+	// Test: Matching ETag or date gives 304 without a body
+	resp = conditional("GET", "If-None-Match: "+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.NotContains(t, resp, "Content-Length")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+	resp = conditional("HEAD", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+
+	// Test: Changed file is sent in full
+	resp = conditional("GET", "If-None-Match: \"old\"\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello world"))
+
+	// Test: Failed If-Match
+	resp = conditional("GET", "If-Match: \"old\"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 412 Precondition Failed\r\n"))
+
+	// Test: If-Range with the current ETag
+	resp = conditional("GET", "Range: bytes=0-4\r\nIf-Range: "+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello"))
+}
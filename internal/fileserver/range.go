@@ -0,0 +1,226 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+)
+
+var errUnsatisfiableRange = errors.New("no range overlaps the content")
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r byteRange) partHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// parseRange parses a Range header (RFC 9110, section 14.2) for content of the
+// given size. A nil result without error means the header should be ignored,
+// either because it is malformed or because serving it would take more than
+// the whole content. Ranges that all start past the end give
+// errUnsatisfiableRange.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	specs, found := strings.CutPrefix(s, "bytes=")
+	if !found {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	var total int64
+	unsatisfiable := false
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, nil
+		}
+
+		var r byteRange
+		if first == "" {
+			// A suffix range selects the last n bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				unsatisfiable = true
+				continue
+			}
+			r.length = min(n, size)
+			r.start = size - r.length
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+			}
+			if start >= size {
+				unsatisfiable = true
+				continue
+			}
+			r.start = start
+			r.length = min(end, size-1) - start + 1
+		}
+		ranges = append(ranges, r)
+		total += r.length
+	}
+
+	if len(ranges) == 0 {
+		if unsatisfiable {
+			return nil, errUnsatisfiableRange
+		}
+		return nil, nil
+	}
+	if total > size {
+		// Overlapping ranges are only a way to make us send more than the
+		// whole file.
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// ifRangeMatches reports whether the representation is unchanged according to
+// If-Range (RFC 9110, section 13.1.5), so that Range can be honored.
+func ifRangeMatches(ifRange string, h *headers.Headers) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		etag := h.Get("ETag")
+		return etag != "" && !strings.HasPrefix(etag, "W/") && etag == ifRange
+	}
+	t, err := time.Parse(response.TimeFormat, ifRange)
+	if err != nil {
+		return false
+	}
+	lastModified, err := time.Parse(response.TimeFormat, h.Get("Last-Modified"))
+	return err == nil && t.Equal(lastModified)
+}
+
+// multipartSize computes the length of a multipart/byteranges body without
+// writing it.
+func multipartSize(ranges []byteRange, contentType string, size int64, boundary string) (int64, error) {
+	cw := &countingWriter{}
+	mw := multipart.NewWriter(cw)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range ranges {
+		_, err = mw.CreatePart(r.partHeader(contentType, size))
+		if err != nil {
+			return 0, err
+		}
+		cw.n += r.length
+	}
+	err = mw.Close()
+	return cw.n, err
+}
+
+func writeMultipart(w io.Writer, content io.ReadSeeker, ranges []byteRange, contentType string, size int64, boundary string) error {
+	mw := multipart.NewWriter(w)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		part, err := mw.CreatePart(r.partHeader(contentType, size))
+		if err != nil {
+			return err
+		}
+		_, err = content.Seek(r.start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(part, content, r.length)
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
+// serveRanges answers a Range request, reporting false if the response should
+// be the whole content instead.
+func serveRanges(w *response.Writer, req *request.Request, name, contentType string, size int64, content io.ReadSeeker) bool {
+	h := w.Header()
+	rangeHeader := req.Headers.Get("Range")
+	if req.RequestLine.Method != "GET" || rangeHeader == "" || !ifRangeMatches(req.Headers.Get("If-Range"), h) {
+		return false
+	}
+	ranges, err := parseRange(rangeHeader, size)
+	if errors.Is(err, errUnsatisfiableRange) {
+		h.Overwrite("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, response.StatusCodeRangeNotSatisfiable, "416 range not satisfiable\n")
+		return true
+	}
+	if len(ranges) == 0 {
+		return false
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		h.Overwrite("Content-Range", r.contentRange(size))
+		h.Overwrite("Content-Length", strconv.FormatInt(r.length, 10))
+		w.WriteStatusLine(response.StatusCodePartialContent)
+		w.WriteHeaders(h)
+		_, err = content.Seek(r.start, io.SeekStart)
+		if err == nil {
+			_, err = io.CopyN(w, content, r.length)
+		}
+	} else {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		var length int64
+		length, err = multipartSize(ranges, contentType, size, boundary)
+		if err != nil {
+			writeError(w, response.StatusCodeInternalServerError, "500 internal server error\n")
+			return true
+		}
+		h.Overwrite("Content-Type", "multipart/byteranges; boundary="+boundary)
+		h.Overwrite("Content-Length", strconv.FormatInt(length, 10))
+		w.WriteStatusLine(response.StatusCodePartialContent)
+		w.WriteHeaders(h)
+		err = writeMultipart(w, content, ranges, contentType, size, boundary)
+	}
+	if err != nil {
+		logSendError(name, err)
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package fileserver
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []byteRange
+		err    error
+	}{
+		{"bytes=0-4", []byteRange{{0, 5}}, nil},
+		{"bytes=6-", []byteRange{{6, 5}}, nil},
+		{"bytes=-3", []byteRange{{8, 3}}, nil},
+		{"bytes=-30", []byteRange{{0, 11}}, nil},
+		{"bytes=5-100", []byteRange{{5, 6}}, nil},
+		{"bytes= 0-1 , 4-5", []byteRange{{0, 2}, {4, 2}}, nil},
+		{"bytes=0-1,20-30", []byteRange{{0, 2}}, nil},
+		{"bytes=20-30", nil, errUnsatisfiableRange},
+		{"bytes=-0", nil, errUnsatisfiableRange},
+		{"bytes=0-10,0-10", nil, nil},
+		{"bytes=4-2", nil, nil},
+		{"bytes=a-b", nil, nil},
+		{"bytes=5", nil, nil},
+		{"items=0-4", nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, 11)
+		assert.ErrorIs(t, err, tt.err, tt.header)
+		assert.Equal(t, tt.want, got, tt.header)
+	}
+}
+
+func TestServeRanges(t *testing.T) {
+	rt := router.New()
+	rt.Mount("/static", New(testFS).ServeHTTP)
+	rangeReq := func(method, rangeHeader, extra string) string {
+		return serveReq(t, rt.ServeHTTP, method+" /static/hello.txt HTTP/1.1\r\nHost: localhost:42069\r\nRange: "+rangeHeader+"\r\n"+extra+"\r\n")
+	}
+
+	// Test: Whole file advertises range support
+	resp := get(t, rt.ServeHTTP, "GET", "/static/hello.txt")
+	assert.Contains(t, resp, "Accept-Ranges: bytes\r\n")
+
+	// Test: Single range
+	resp = rangeReq("GET", "bytes=6-", "")
+	assert.Contains(t, resp, "HTTP/1.1 206 Partial Content\r\n")
+	assert.Contains(t, resp, "Content-Range: bytes 6-10/11\r\n")
+	assert.Contains(t, resp, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nworld"))
+
+	// Test: Multiple ranges
+	resp = rangeReq("GET", "bytes=0-1,-3", "")
+	assert.Contains(t, resp, "HTTP/1.1 206 Partial Content\r\n")
+	head, body, _ := strings.Cut(resp, "\r\n\r\n")
+	var contentType string
+	for _, line := range strings.Split(head, "\r\n") {
+		if v, found := strings.CutPrefix(line, "Content-Type: "); found {
+			contentType = v
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body)))
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	for _, want := range []struct{ contentRange, data string }{
+		{"bytes 0-1/11", "he"},
+		{"bytes 8-10/11", "rld"},
+	} {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, want.contentRange, part.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, want.data, string(data))
+	}
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Unsatisfiable range
+	resp = rangeReq("GET", "bytes=20-", "")
+	assert.Contains(t, resp, "HTTP/1.1 416 Range Not Satisfiable\r\n")
+	assert.Contains(t, resp, "Content-Range: bytes */11\r\n")
+
+	// Test: Malformed range and HEAD are served whole
+	resp = rangeReq("GET", "bytes=x-y", "")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	resp = rangeReq("HEAD", "bytes=0-4", "")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+
+	// Test: If-Range with a matching date
+	resp = rangeReq("GET", "bytes=0-4", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 206 Partial Content\r\n")
+
+	// Test: If-Range with a stale date or unknown ETag
+	resp = rangeReq("GET", "bytes=0-4", "If-Range: Thu, 29 Feb 2024 12:00:00 GMT\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	resp = rangeReq("GET", "bytes=0-4", "If-Range: \"abc\"\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+}
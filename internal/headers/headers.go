@@ -3,19 +3,32 @@ package headers
 import (
 	"bytes"
 	"errors"
+	"io"
+	"iter"
+	"net/textproto"
 	"strings"
 	"unicode"
 )
 
 const CRLF = "\r\n"
 
-type Headers map[string]string
+type field struct {
+	name  string
+	value string
+}
+
+// Headers is an ordered list of header fields. Field names keep the casing
+// they were parsed or set with, lookups are case-insensitive and a name may
+// appear more than once.
+type Headers struct {
+	fields []field
+}
 
-func NewHeaders() Headers {
-	return Headers{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	endIndex := bytes.Index(data, []byte(CRLF))
 	if endIndex == -1 {
 		return 0, false, nil
@@ -39,15 +52,11 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 0, false, errors.New("invalid header line: field name contains invalid characters")
 	}
 
-	fieldName := strings.ToLower(parts[0])
+	fieldName := parts[0]
 	fieldValue := strings.TrimSpace(parts[1])
 	fieldValue = strings.TrimSuffix(fieldValue, ";")
 
-	if existingValue, exists := h[fieldName]; exists {
-		h[fieldName] = existingValue + ", " + fieldValue
-	} else {
-		h[fieldName] = fieldValue
-	}
+	h.Add(fieldName, fieldValue)
 
 	return endIndex + 2, false, nil
 }
@@ -62,23 +71,112 @@ func validateFieldName(fieldName string) (valid bool) {
 	return true
 }
 
-func (h Headers) Get(key string) (value string) {
-	return h[strings.ToLower(key)]
+// Get returns every value of key joined with ", ", which is equivalent for
+// list-based fields. Use Values for fields such as Set-Cookie that must not
+// be combined.
+func (h *Headers) Get(key string) (value string) {
+	return strings.Join(h.Values(key), ", ")
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	if ok {
-		value = strings.Join([]string{
-			v,
-			value,
-		}, ", ")
+func (h *Headers) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
 	}
-	h[key] = value
+	return values
+}
+
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Set adds another value for key. Existing values are kept, so Get returns
+// them joined with the new one.
+func (h *Headers) Set(key, value string) {
+	h.Add(key, value)
 }
 
-func (h Headers) Overwrite(key, value string) {
-	k := strings.ToLower(key)
-	h[k] = value
+// Overwrite replaces every value of key with value, keeping the position of
+// the first existing field.
+func (h *Headers) Overwrite(key, value string) {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			h.fields[i] = field{name: key, value: value}
+			h.del(key, i+1)
+			return
+		}
+	}
+	h.Add(key, value)
+}
+
+func (h *Headers) Del(key string) {
+	h.del(key, 0)
+}
+
+func (h *Headers) del(key string, from int) {
+	fields := h.fields[:from]
+	for _, f := range h.fields[from:] {
+		if !strings.EqualFold(f.name, key) {
+			fields = append(fields, f)
+		}
+	}
+	h.fields = fields
+}
+
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All iterates over the fields in order, with names as they were added.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Headers) Clone() *Headers {
+	c := NewHeaders()
+	if h != nil {
+		c.fields = append(c.fields, h.fields...)
+	}
+	return c
+}
+
+// WriteTo writes each field on its own line, in order and with a canonical
+// name such as "Content-Type". The blank line ending the section is not
+// written.
+func (h *Headers) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for name, value := range h.All() {
+		n, err := io.WriteString(w, textproto.CanonicalMIMEHeaderKey(name)+": "+value+CRLF)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (h *Headers) ContainsToken(key, token string) bool {
+	for _, v := range strings.Split(h.Get(key), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,7 @@
 package headers
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,7 +15,7 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -32,7 +33,7 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 27, n)
 	assert.False(t, done)
 
@@ -64,5 +65,51 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 29, n)
 	require.False(t, done)
 
-	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
+	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers.Get("set-person"))
+}
+
+func TestHeadersMultiValue(t *testing.T) {
+	// Test: Duplicate fields are kept separately and in order
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1; Path=/\r\nContent-Type: text/html\r\nset-cookie: b=2\r\n\r\n")
+	total := 0
+	for {
+		n, done, err := headers.Parse(data[total:])
+		require.NoError(t, err)
+		total += n
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a=1; Path=/", "b=2"}, headers.Values("Set-Cookie"))
+	assert.Equal(t, "a=1; Path=/, b=2", headers.Get("set-cookie"))
+	assert.Equal(t, 3, headers.Len())
+
+	// Test: Original casing and order are preserved
+	var names []string
+	for name := range headers.All() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Set-Cookie", "Content-Type", "set-cookie"}, names)
+
+	// Test: Serialization is ordered with canonical names
+	buf := &bytes.Buffer{}
+	_, err := headers.WriteTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Set-Cookie: a=1; Path=/\r\nContent-Type: text/html\r\nSet-Cookie: b=2\r\n", buf.String())
+
+	// Test: Overwrite keeps the position of the first field
+	headers.Overwrite("SET-COOKIE", "c=3")
+	assert.Equal(t, []string{"c=3"}, headers.Values("Set-Cookie"))
+	buf.Reset()
+	_, err = headers.WriteTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Set-Cookie: c=3\r\nContent-Type: text/html\r\n", buf.String())
+
+	// Test: Del removes every value
+	headers.Add("Content-Type", "text/plain")
+	headers.Del("content-type")
+	assert.Empty(t, headers.Values("Content-Type"))
+	assert.Equal(t, "", headers.Get("Content-Type"))
+	assert.Equal(t, 1, headers.Len())
 }
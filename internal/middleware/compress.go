@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+// DefaultCompressMinSize is the body size below which Compress leaves
+// responses alone; compressing them saves too little to be worth it.
+const DefaultCompressMinSize = 1024
+
+// Encoder is a content coding Compress can apply, such as gzip.
+type Encoder interface {
+	// Name is the content-coding token used in Accept-Encoding and
+	// Content-Encoding.
+	Name() string
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+type GzipEncoder struct {
+	Level int
+}
+
+func (GzipEncoder) Name() string {
+	return "gzip"
+}
+
+func (e GzipEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	zw, err := gzip.NewWriterLevel(w, e.Level)
+	if err != nil {
+		zw = gzip.NewWriter(w)
+	}
+	return zw
+}
+
+// DeflateEncoder produces the "deflate" coding, which is the zlib format
+// (RFC 9110, section 8.4.1.2).
+type DeflateEncoder struct {
+	Level int
+}
+
+func (DeflateEncoder) Name() string {
+	return "deflate"
+}
+
+func (e DeflateEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	zw, err := zlib.NewWriterLevel(w, e.Level)
+	if err != nil {
+		zw = zlib.NewWriter(w)
+	}
+	return zw
+}
+
+// Compress compresses responses with gzip or deflate, whichever the client
+// prefers. See CompressWith.
+func Compress(next server.Handler) server.Handler {
+	return CompressWith(DefaultCompressMinSize,
+		GzipEncoder{Level: gzip.DefaultCompression},
+		DeflateEncoder{Level: zlib.DefaultCompression},
+	)(next)
+}
+
+// CompressWith returns a middleware compressing responses with the encoder
+// the client ranks highest in Accept-Encoding; ties go to the earlier encoder.
+// Responses that already have a Content-Encoding, hold a range, have an
+// already compressed type such as images or video, or are shorter than
+// minSize are left alone. Without a Content-Length, up to minSize bytes of
+// body are held back to decide. Compressed responses lose their
+// Content-Length, so the writer computes a new one or switches to chunked
+// encoding. Responses to HEAD are never compressed: without a body, the length
+// of the compressed one is unknown.
+func CompressWith(minSize int, encoders ...Encoder) Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			encoder := negotiateEncoding(req.Headers.Get("Accept-Encoding"), encoders)
+			w.OnWriteHeaders(func(h *headers.Headers) {
+				// A 304 carries the Vary its 200 would have (RFC 9110, section
+				// 15.4.5), and there is no Content-Type left to tell.
+				notModified := w.StatusCode() == response.StatusCodeNotModified
+				if !notModified && !compressible(w.StatusCode(), h) {
+					return
+				}
+				if !h.ContainsToken("Vary", "Accept-Encoding") {
+					h.Add("Vary", "Accept-Encoding")
+				}
+				if notModified {
+					return
+				}
+				if encoder == nil || req.RequestLine.Method == "HEAD" {
+					return
+				}
+				n, err := strconv.Atoi(h.Get("Content-Length"))
+				if err == nil && n < minSize {
+					return
+				}
+				etag := h.Get("ETag")
+				h.Del("Content-Length")
+				h.Set("Content-Encoding", encoder.Name())
+				if strings.HasPrefix(etag, `"`) {
+					// The compressed bytes differ from the original ones.
+					h.Overwrite("ETag", "W/"+etag)
+				}
+				if err == nil || h.ContainsToken("Transfer-Encoding", "chunked") {
+					w.SetBodyFilter(encoder.NewWriter)
+					return
+				}
+				w.SetBodyFilter(func(body io.Writer) io.WriteCloser {
+					return &deferredEncoder{w: w, h: h, etag: etag, encoder: encoder, body: body, minSize: minSize}
+				})
+			})
+			next(w, req)
+		}
+	}
+}
+
+// deferredEncoder holds back the start of a body of unknown length until it
+// is known to reach minSize. A shorter body is sent as is, as long as the
+// headers can still be changed to say so.
+type deferredEncoder struct {
+	w       *response.Writer
+	h       *headers.Headers
+	etag    string
+	encoder Encoder
+	body    io.Writer
+	minSize int
+
+	held       []byte
+	compressor io.WriteCloser
+	identity   bool
+}
+
+func (d *deferredEncoder) Write(p []byte) (int, error) {
+	switch {
+	case d.compressor != nil:
+		return d.compressor.Write(p)
+	case d.identity:
+		return d.body.Write(p)
+	}
+	d.held = append(d.held, p...)
+	if len(d.held) >= d.minSize {
+		err := d.startCompressing()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (d *deferredEncoder) startCompressing() error {
+	d.compressor = d.encoder.NewWriter(d.body)
+	held := d.held
+	d.held = nil
+	_, err := d.compressor.Write(held)
+	return err
+}
+
+// Flush commits to compressing, since the headers are about to be sent.
+func (d *deferredEncoder) Flush() error {
+	if d.compressor == nil && !d.identity {
+		err := d.startCompressing()
+		if err != nil {
+			return err
+		}
+	}
+	if f, ok := d.compressor.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (d *deferredEncoder) Close() error {
+	if d.compressor == nil && !d.identity {
+		if d.w.HeadersSent() {
+			// Content-Encoding is already out; the body has to match it.
+			err := d.startCompressing()
+			if err != nil {
+				return err
+			}
+		} else {
+			d.identity = true
+			d.h.Del("Content-Encoding")
+			if d.etag != "" {
+				d.h.Overwrite("ETag", d.etag)
+			}
+			_, err := d.body.Write(d.held)
+			d.held = nil
+			return err
+		}
+	}
+	if d.compressor == nil {
+		return nil
+	}
+	return d.compressor.Close()
+}
+
+func compressible(statusCode response.StatusCode, h *headers.Headers) bool {
+	if statusCode < 200 || statusCode == response.StatusCodeNoContent ||
+		statusCode == response.StatusCodeNotModified || statusCode == response.StatusCodePartialContent {
+		return false
+	}
+	if h.Get("Content-Range") != "" {
+		return false
+	}
+	if encoding := h.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+		"application/vnd.rar", "application/pdf", "multipart/byteranges":
+		return false
+	}
+	return true
+}
+
+// negotiateEncoding picks the encoder with the highest q-value in an
+// Accept-Encoding header (RFC 9110, section 12.5.3), or nil if identity is
+// preferred or the header is missing.
+func negotiateEncoding(acceptEncoding string, encoders []Encoder) Encoder {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return nil
+	}
+
+	qvalues := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		qvalues[name] = q
+	}
+	qvalue := func(name string) float64 {
+		if q, ok := qvalues[name]; ok {
+			return q
+		}
+		if q, ok := qvalues["*"]; ok {
+			return q
+		}
+		return 0
+	}
+
+	var best Encoder
+	bestQ := 0.0
+	for _, e := range encoders {
+		if q := qvalue(e.Name()); q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	// Only an explicit preference for identity over every encoder stops
+	// compression.
+	if best == nil || qvalues["identity"] > bestQ {
+		return nil
+	}
+	return best
+}
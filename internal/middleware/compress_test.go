@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var page = strings.Repeat("<p>The quick brown fox jumps over the lazy dog.</p>\n", 100)
+
+func serveCompressed(t *testing.T, h server.Handler, extraHeaders string) (string, string) {
+	return serveCompressedRequest(t, h, newRequest(t, extraHeaders))
+}
+
+func serveCompressedRequest(t *testing.T, h server.Handler, req *request.Request) (string, string) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequest(req)
+	Compress(h)(w, req)
+	require.NoError(t, w.Finish())
+	head, body, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	return head, body
+}
+
+func TestCompress(t *testing.T) {
+	htmlPage := func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(page))
+	}
+
+	// Test: Gzip when preferred
+	head, body := serveCompressed(t, htmlPage, "Accept-Encoding: deflate;q=0.5, gzip\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Contains(t, head, "Etag: W/\"v1\"\r\n")
+	assert.Contains(t, head, "Content-Length: ")
+	assert.Less(t, len(body), len(page))
+	zr, err := gzip.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(decoded))
+
+	// Test: Deflate when preferred
+	head, body = serveCompressed(t, htmlPage, "Accept-Encoding: gzip;q=0.1, deflate\r\n")
+	assert.Contains(t, head, "Content-Encoding: deflate\r\n")
+	zr2, err := zlib.NewReader(strings.NewReader(body))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(decoded))
+
+	// Test: Not accepted
+	for _, acceptEncoding := range []string{"", "Accept-Encoding: identity\r\n", "Accept-Encoding: gzip;q=0, br\r\n", "Accept-Encoding: gzip;q=0.5, identity\r\n"} {
+		head, body = serveCompressed(t, htmlPage, acceptEncoding)
+		assert.NotContains(t, head, "Content-Encoding", acceptEncoding)
+		assert.Contains(t, head, "Vary: Accept-Encoding\r\n", acceptEncoding)
+		assert.Equal(t, page, body, acceptEncoding)
+	}
+
+	// Test: Wildcard
+	head, _ = serveCompressed(t, htmlPage, "Accept-Encoding: *\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+
+	// Test: Small and already compressed bodies are left alone
+	head, body = serveCompressed(t, ok, "Accept-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Equal(t, "ok", body)
+	short := func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("ok"))
+	}
+	head, body = serveCompressed(t, short, "Accept-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Content-Length: 2\r\n")
+	assert.Contains(t, head, "Etag: \"v1\"\r\n")
+	assert.Equal(t, "ok", body)
+	video := func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte(page))
+	}
+	head, _ = serveCompressed(t, video, "Accept-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.NotContains(t, head, "Vary")
+
+	// Test: 304 keeps Vary but has no Content-Encoding
+	notModified := func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		if response.CheckPreconditions(w, req) {
+			return
+		}
+		w.Write([]byte(page))
+	}
+	head, body = serveCompressed(t, notModified, "Accept-Encoding: gzip\r\nIf-None-Match: W/\"v1\"\r\n")
+	assert.True(t, strings.HasPrefix(head, "HTTP/1.1 304 Not Modified\r\n"), head)
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Empty(t, body)
+
+	// Test: HEAD is not compressed and keeps the length of the body
+	fixedLength := func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		w.WriteStatusLine(response.StatusCodeOK)
+		w.WriteHeaders(w.Header())
+		if req.RequestLine.Method != "HEAD" {
+			w.WriteBody([]byte(page))
+		}
+	}
+	head, body = serveCompressed(t, fixedLength, "Accept-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Less(t, len(body), len(page))
+	req, err := request.RequestFromReader(strings.NewReader("HEAD / HTTP/1.1\r\nHost: localhost:42069\r\nAccept-Encoding: gzip\r\n\r\n"))
+	require.NoError(t, err)
+	head, body = serveCompressedRequest(t, fixedLength, req)
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(page))+"\r\n")
+	assert.Empty(t, body)
+
+	// Test: Flush before the body reaches the minimum size commits to compressing
+	flushed := func(w *response.Writer, _ *request.Request) {
+		w.Write([]byte("hello "))
+		w.Flush()
+		w.Write([]byte("world"))
+	}
+	head, body = serveCompressed(t, flushed, "Accept-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	req, err = request.RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n" + body))
+	require.NoError(t, err)
+	zr, err = gzip.NewReader(bytes.NewReader(req.Body))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(decoded))
+
+	// Test: Streamed body becomes chunked and survives Flush
+	stream := func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteStatusLine(response.StatusCodeOK)
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteHeaders(h)
+		for i := 0; i < 3; i++ {
+			w.WriteChunkedBody([]byte(page))
+			w.Flush()
+		}
+	}
+	head, body = serveCompressed(t, stream, "Accept-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	req, err = request.RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n" + body))
+	require.NoError(t, err)
+	zr, err = gzip.NewReader(bytes.NewReader(req.Body))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(page, 3), string(decoded))
+}
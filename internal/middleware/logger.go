@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+func Logger(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		log.Printf("%s %s %d %dB %v %s",
+			req.RequestLine.Method,
+			req.RequestLine.RequestTarget,
+			w.StatusCode(),
+			w.BytesWritten(),
+			time.Since(start),
+			req.Headers.Get(RequestIDHeader),
+		)
+	}
+}
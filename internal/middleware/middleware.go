@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+type Middleware func(server.Handler) server.Handler
+
+// Chain composes middlewares into one. The first middleware is the outermost,
+// so it sees the request first and the finished response last.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler server.Handler) server.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
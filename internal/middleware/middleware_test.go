@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, extraHeaders string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n" + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func ok(w *response.Writer, _ *request.Request) {
+	body := []byte("ok")
+	w.WriteStatusLine(response.StatusCodeOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestChain(t *testing.T) {
+	// Test: First middleware is outermost
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" before")
+				next(w, req)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	h := Chain(trace("a"), trace("b"))(ok)
+	h(response.NewWriter(&bytes.Buffer{}), newRequest(t, ""))
+	assert.Equal(t, []string{"a before", "b before", "b after", "a after"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	// Test: Panic before writing becomes a 500
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	Recover(func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})(w, newRequest(t, ""))
+	w.Finish()
+	assert.Equal(t, response.StatusCodeInternalServerError, w.StatusCode())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 500 Internal Server Error\r\n"))
+
+	// Test: Headers and hooks set up by the handler are left out of the 500
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	w.OnWriteHeaders(func(h *headers.Headers) { h.Set("X-Outer", "1") })
+	Recover(func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.OnWriteHeaders(func(h *headers.Headers) { h.Set("X-Inner", "1") })
+		panic("boom")
+	})(w, newRequest(t, ""))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "X-Outer: 1\r\n")
+	assert.NotContains(t, buf.String(), "X-Inner")
+	assert.NotContains(t, buf.String(), "Set-Cookie")
+
+	// Test: Panic after writing aborts the response
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	Recover(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCodeOK)
+		panic("boom")
+	})(w, newRequest(t, ""))
+	require.Error(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+	assert.Empty(t, buf.String())
+}
+
+func TestRequestID(t *testing.T) {
+	// Test: Generated ID is set on the request and echoed in the response
+	buf := &bytes.Buffer{}
+	req := newRequest(t, "")
+	w := response.NewWriter(buf)
+	RequestID(ok)(w, req)
+	w.Finish()
+	id := req.Headers.Get(RequestIDHeader)
+	assert.Len(t, id, 32)
+	assert.Contains(t, buf.String(), id)
+
+	// Test: Client ID is kept
+	buf = &bytes.Buffer{}
+	req = newRequest(t, "X-Request-Id: abc123\r\n")
+	w = response.NewWriter(buf)
+	RequestID(ok)(w, req)
+	w.Finish()
+	assert.Equal(t, "abc123", req.Headers.Get(RequestIDHeader))
+	assert.Contains(t, buf.String(), "abc123")
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+// Recover turns a panic in next into a 500 response if nothing has been
+// written yet, leaving out the headers and hooks next set up. Otherwise the
+// response is aborted and the server closes the connection.
+func Recover(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		mark := w.Mark()
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, v, debug.Stack())
+			if w.StatusCode() != 0 {
+				w.Abort()
+				return
+			}
+			w.ResetTo(mark)
+			body := []byte("internal server error\n")
+			w.WriteStatusLine(response.StatusCodeInternalServerError)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+		}()
+		next(w, req)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID makes sure every request carries an X-Request-Id header, keeping
+// the client's if it sent one, and echoes it in the response.
+func RequestID(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		id := req.Headers.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			req.Headers.Overwrite(RequestIDHeader, id)
+		}
+		w.OnWriteHeaders(func(h *headers.Headers) {
+			if h.Get(RequestIDHeader) == "" {
+				h.Overwrite(RequestIDHeader, id)
+			}
+		})
+		next(w, req)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+// Timing adds a Server-Timing header with the time spent in the handler
+// before the response headers were written.
+func Timing(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		w.OnWriteHeaders(func(h *headers.Headers) {
+			elapsed := float64(time.Since(start).Microseconds()) / 1000
+			h.Set("Server-Timing", fmt.Sprintf("app;dur=%.3f", elapsed))
+		})
+		next(w, req)
+	}
+}
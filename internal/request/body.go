@@ -0,0 +1,222 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	bodyBufferSize    = 32 * 1024
+	discardBufferSize = 4 * 1024
+	// maxDiscardBytes is how much unread body DiscardBody reads before giving
+	// up; past that, closing the connection is cheaper.
+	maxDiscardBytes   = 256 * 1024
+	maxChunkLineBytes = 4 * 1024
+)
+
+type body struct {
+	req    *Request
+	reader *Reader
+	closed bool
+	err    error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+	return b.read(p)
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *body) read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for b.req.state != requestStateDone {
+		prevState := b.req.state
+		numBytesParsed, numBytesWritten, err := b.req.parseBody(b.reader.buf[:b.reader.readToIndex], p)
+		if err != nil {
+			b.err = fmt.Errorf("error parsing request body: %w", err)
+			return 0, b.err
+		}
+		b.reader.discard(numBytesParsed)
+
+		if numBytesWritten > 0 {
+			return numBytesWritten, nil
+		}
+		if numBytesParsed > 0 || b.req.state != prevState {
+			continue
+		}
+
+		if b.req.expectContinue {
+			// The client waits for the go-ahead before sending the body.
+			b.req.expectContinue = false
+			if b.req.continueFunc != nil {
+				err = b.req.continueFunc()
+				if err != nil {
+					b.err = fmt.Errorf("unable to send 100 Continue: %w", err)
+					return 0, b.err
+				}
+			}
+		}
+
+		b.reader.reserve(min(len(p), bodyBufferSize))
+		err = b.reader.fill()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("incomplete request body, in state: %d: %w", b.req.state, io.ErrUnexpectedEOF)
+			}
+			b.err = err
+			return 0, b.err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (rr *Reader) reserve(n int) {
+	if len(rr.buf)-rr.readToIndex >= n {
+		return
+	}
+	newBuf := make([]byte, rr.readToIndex+n)
+	copy(newBuf, rr.buf[:rr.readToIndex])
+	rr.buf = newBuf
+}
+
+func (r *Request) beginBody() error {
+	if transferEncoding := r.Headers.Get("Transfer-Encoding"); transferEncoding != "" {
+		if r.Headers.Get("Content-Length") != "" {
+			return errors.New("error: request has both transfer-encoding and content-length headers")
+		}
+		if !strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked") {
+			return fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, transferEncoding)
+		}
+		r.state = requestStateParsingChunkSize
+		return nil
+	}
+
+	contentLength := r.Headers.Get("Content-Length")
+	if contentLength == "" {
+		// Content-length header does not exist. Nothing to parse.
+		r.state = requestStateDone
+		return nil
+	}
+	if strings.TrimLeft(contentLength, "0123456789") != "" {
+		// Signs and spaces are not valid framing, and servers disagreeing
+		// about them is how requests get smuggled.
+		return errors.New("error: content-length must only contain digits")
+	}
+	n, err := strconv.Atoi(contentLength)
+	if err != nil {
+		return errors.New("error: unable to convert content-length string to int")
+	}
+	if r.limits.MaxBodyBytes > 0 && int64(n) > r.limits.MaxBodyBytes {
+		return ErrBodyTooLarge
+	}
+	if n == 0 {
+		r.state = requestStateDone
+		return nil
+	}
+	r.bodyBytesRemaining = n
+	r.state = requestStateParsingBody
+	return nil
+}
+
+// parseBody decodes as much of data as it can, copying body bytes into p.
+// Framing bytes (chunk sizes, CRLFs, trailers) are consumed without being
+// written. Anything past the end of the body is left for the next request.
+func (r *Request) parseBody(data, p []byte) (numBytesParsed, numBytesWritten int, err error) {
+	switch r.state {
+	case requestStateParsingBody:
+		n := min(len(data), len(p), r.bodyBytesRemaining)
+		copy(p, data[:n])
+		r.bodyBytesRemaining -= n
+		if r.bodyBytesRemaining == 0 {
+			r.state = requestStateDone
+		}
+		return n, n, nil
+	case requestStateParsingChunkSize:
+		endIndex := bytes.Index(data, []byte(CRLF))
+		if endIndex == -1 {
+			if len(data) > maxChunkLineBytes {
+				return 0, 0, errors.New("error: chunk size line too long")
+			}
+			return 0, 0, nil
+		}
+		chunkSize, err := parseChunkSize(string(data[:endIndex]))
+		if err != nil {
+			return 0, 0, err
+		}
+		r.chunkedBodyBytes += int64(chunkSize)
+		if r.limits.MaxBodyBytes > 0 && r.chunkedBodyBytes > r.limits.MaxBodyBytes {
+			return 0, 0, ErrBodyTooLarge
+		}
+		if chunkSize == 0 {
+			r.state = requestStateParsingTrailers
+		} else {
+			r.chunkBytesRemaining = chunkSize
+			r.state = requestStateParsingChunkData
+		}
+		return endIndex + 2, 0, nil
+	case requestStateParsingChunkData:
+		n := min(len(data), len(p), r.chunkBytesRemaining)
+		copy(p, data[:n])
+		r.chunkBytesRemaining -= n
+		if r.chunkBytesRemaining == 0 {
+			r.state = requestStateParsingChunkDataEnd
+		}
+		return n, n, nil
+	case requestStateParsingChunkDataEnd:
+		if len(data) < 2 {
+			return 0, 0, nil
+		}
+		if string(data[:2]) != CRLF {
+			return 0, 0, errors.New("error: chunk data not followed by CRLF")
+		}
+		r.state = requestStateParsingChunkSize
+		return 2, 0, nil
+	case requestStateParsingTrailers:
+		n, done, err := r.Trailers.Parse(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = r.checkHeaderLimits(len(data), n, done)
+		if err != nil {
+			return 0, 0, err
+		}
+		if done {
+			r.state = requestStateDone
+		}
+		return n, 0, nil
+	case requestStateDone:
+		return 0, 0, nil
+	default:
+		return 0, 0, errors.New("unknown state")
+	}
+}
+
+func parseChunkSize(line string) (int, error) {
+	// Chunk extensions are allowed after a semicolon and are ignored.
+	sizeStr, _, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimSpace(sizeStr)
+	if sizeStr == "" {
+		return 0, errors.New("error: missing chunk size")
+	}
+	chunkSize, err := strconv.ParseUint(sizeStr, 16, 31)
+	if err != nil {
+		return 0, fmt.Errorf("error: invalid chunk size: %s", sizeStr)
+	}
+	return int(chunkSize), nil
+}
@@ -0,0 +1,59 @@
+package request
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrNoCookie = errors.New("named cookie not present")
+
+type Cookie struct {
+	Name  string
+	Value string
+}
+
+// Cookies parses the Cookie headers sent with the request. Whitespace around
+// pairs and double quotes around values are removed; malformed pairs are
+// skipped.
+func (r *Request) Cookies() []Cookie {
+	var cookies []Cookie
+	for _, line := range r.Headers.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			name = strings.TrimSpace(name)
+			if !found || !isToken(name) {
+				continue
+			}
+			value, ok := parseCookieValue(strings.TrimSpace(value))
+			if !ok {
+				continue
+			}
+			cookies = append(cookies, Cookie{Name: name, Value: value})
+		}
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie with the given name, or ErrNoCookie.
+func (r *Request) Cookie(name string) (Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Cookie{}, ErrNoCookie
+}
+
+func parseCookieValue(s string) (string, bool) {
+	if len(s) > 1 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for _, c := range []byte(s) {
+		// More lenient than RFC 6265, section 4.1.1: spaces and commas are
+		// let through since some clients send them unquoted.
+		if c < 0x20 || c >= 0x7f || c == '"' || c == ';' || c == '\\' {
+			return "", false
+		}
+	}
+	return s, true
+}
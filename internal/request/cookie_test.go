@@ -0,0 +1,45 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookies(t *testing.T) {
+	// Test: Pairs from several Cookie headers
+	reader := &chunkReader{
+		data: "GET / HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Cookie: session=abc123;theme=dark ;  lang=\"en US\"\r\n" +
+			"Cookie: cart=1,2,3; bad name=x; novalue; quote=a\"b; empty=\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []Cookie{
+		{Name: "session", Value: "abc123"},
+		{Name: "theme", Value: "dark"},
+		{Name: "lang", Value: "en US"},
+		{Name: "cart", Value: "1,2,3"},
+		{Name: "empty", Value: ""},
+	}, r.Cookies())
+
+	// Test: Lookup by name
+	c, err := r.Cookie("theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", c.Value)
+	_, err = r.Cookie("missing")
+	require.ErrorIs(t, err, ErrNoCookie)
+
+	// Test: No Cookie header
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Empty(t, r.Cookies())
+}
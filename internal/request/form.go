@@ -0,0 +1,177 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"slices"
+)
+
+const (
+	// DefaultMaxMemory is how much of a multipart form FormValue and FormFile
+	// keep in memory; file parts beyond it are stored in temporary files.
+	DefaultMaxMemory = 32 * 1024 * 1024
+	maxFormBytes     = 10 * 1024 * 1024
+)
+
+var (
+	ErrNotMultipart     = errors.New("request Content-Type isn't multipart/form-data")
+	ErrMissingBoundary  = errors.New("no multipart boundary param in Content-Type")
+	ErrMissingFormFile  = errors.New("no such file in multipart form")
+	ErrMultipartStarted = errors.New("multipart body already being read")
+)
+
+// ParseForm fills Form with the query parameters and, for POST, PUT and PATCH
+// requests with an application/x-www-form-urlencoded body, PostForm with the
+// body's fields. Body fields come first in Form. Only the first call does any
+// work.
+func (r *Request) ParseForm() error {
+	if r.PostForm == nil {
+		r.PostForm = url.Values{}
+		if r.hasFormBody() && r.mediaType() == "application/x-www-form-urlencoded" {
+			b, err := io.ReadAll(io.LimitReader(r.bodyReader(), maxFormBytes+1))
+			if err != nil {
+				return fmt.Errorf("unable to read form body: %w", err)
+			}
+			if len(b) > maxFormBytes {
+				return ErrBodyTooLarge
+			}
+			r.PostForm, err = url.ParseQuery(string(b))
+			if err != nil {
+				return fmt.Errorf("unable to parse form body: %w", err)
+			}
+		}
+	}
+	if r.Form == nil {
+		r.Form = url.Values{}
+		copyValues(r.Form, r.PostForm)
+		copyValues(r.Form, r.Target.Query)
+	}
+	return nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body into MultipartForm,
+// adding its non-file fields to Form and PostForm. Up to maxMemory bytes of
+// file parts are kept in memory, the rest is written to temporary files which
+// the server removes once the handler returns. ParseForm is called first.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	form, err := mr.ReadForm(maxMemory)
+	if err != nil {
+		return fmt.Errorf("unable to parse multipart form: %w", err)
+	}
+	r.MultipartForm = form
+	copyValues(r.PostForm, form.Value)
+	for key, values := range form.Value {
+		// Body fields go before query parameters, as in ParseForm.
+		r.Form[key] = append(slices.Clone(values), r.Form[key]...)
+	}
+	return nil
+}
+
+// MultipartReader returns a reader over the parts of a multipart/form-data
+// body, for handlers that want to stream parts instead of calling
+// ParseMultipartForm.
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	if r.multipartStarted {
+		return nil, ErrMultipartStarted
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, ErrMissingBoundary
+	}
+	r.multipartStarted = true
+	return multipart.NewReader(r.bodyReader(), boundary), nil
+}
+
+// FormValue returns the first value for key from the body or the query,
+// parsing the form if needed. Parse errors are ignored; call ParseForm or
+// ParseMultipartForm directly to see them.
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil || r.MultipartForm == nil {
+		r.ParseMultipartForm(DefaultMaxMemory)
+	}
+	return r.Form.Get(key)
+}
+
+// PostFormValue is like FormValue but ignores the query.
+func (r *Request) PostFormValue(key string) string {
+	if r.PostForm == nil || r.MultipartForm == nil {
+		r.ParseMultipartForm(DefaultMaxMemory)
+	}
+	return r.PostForm.Get(key)
+}
+
+// FormFile returns the first file uploaded as key, parsing the multipart form
+// if needed.
+func (r *Request) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
+	if r.MultipartForm == nil {
+		err := r.ParseMultipartForm(DefaultMaxMemory)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	files := r.MultipartForm.File[key]
+	if len(files) == 0 {
+		return nil, nil, ErrMissingFormFile
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, files[0], nil
+}
+
+// RemoveFormFiles deletes the temporary files created by ParseMultipartForm.
+func (r *Request) RemoveFormFiles() error {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.RemoveAll()
+}
+
+func (r *Request) hasFormBody() bool {
+	switch r.RequestLine.Method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return false
+}
+
+func (r *Request) mediaType() string {
+	mediaType, _, _ := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	return mediaType
+}
+
+// bodyReader returns the whole body, including any part already buffered into
+// Body by ReadBody.
+func (r *Request) bodyReader() io.Reader {
+	if len(r.Body) == 0 {
+		return r.BodyReader
+	}
+	return io.MultiReader(bytes.NewReader(r.Body), r.BodyReader)
+}
+
+func copyValues(dst, src url.Values) {
+	for key, values := range src {
+		dst[key] = append(dst[key], values...)
+	}
+}
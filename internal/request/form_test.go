@@ -0,0 +1,113 @@
+package request
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formRequest(t *testing.T, target, contentType, body string) *Request {
+	data := "POST " + target + " HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" + body
+	r, err := NewReader(&chunkReader{data: data, numBytesPerRead: 7}).ReadRequest()
+	require.NoError(t, err)
+	return r
+}
+
+const multipartBody = "--xyz\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"holiday\r\n" +
+	"--xyz\r\n" +
+	"Content-Disposition: form-data; name=\"photo\"; filename=\"beach.txt\"\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"sand and sea\r\n" +
+	"--xyz--\r\n"
+
+func TestParseForm(t *testing.T) {
+	// Test: URL-encoded body and query
+	r := formRequest(t, "/submit?name=query&page=2", "application/x-www-form-urlencoded", "name=body&flavor=caf%C3%A9")
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"body", "query"}, r.Form["name"])
+	assert.Equal(t, "2", r.FormValue("page"))
+	assert.Equal(t, "café", r.PostFormValue("flavor"))
+	assert.Equal(t, "", r.PostFormValue("page"))
+
+	// Test: Body already buffered by ReadBody
+	r = formRequest(t, "/submit", "application/x-www-form-urlencoded", "name=body")
+	_, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "body", r.FormValue("name"))
+
+	// Test: Other content types leave the body alone
+	r = formRequest(t, "/submit?name=query", "text/plain", "name=body")
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "query", r.FormValue("name"))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "name=body", string(body))
+
+	// Test: Invalid body
+	r = formRequest(t, "/submit", "application/x-www-form-urlencoded", "name=%zz")
+	require.Error(t, r.ParseForm())
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	// Test: Fields and files
+	r := formRequest(t, "/upload?title=query", "multipart/form-data; boundary=xyz", multipartBody)
+	require.NoError(t, r.ParseMultipartForm(1024))
+	assert.Equal(t, []string{"holiday", "query"}, r.Form["title"])
+	assert.Equal(t, "holiday", r.PostFormValue("title"))
+	f, fh, err := r.FormFile("photo")
+	require.NoError(t, err)
+	assert.Equal(t, "beach.txt", fh.Filename)
+	assert.Equal(t, int64(12), fh.Size)
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "sand and sea", string(content))
+	f.Close()
+	_, _, err = r.FormFile("missing")
+	require.ErrorIs(t, err, ErrMissingFormFile)
+
+	// Test: Files over maxMemory are spilled to disk and removed
+	r = formRequest(t, "/upload", "multipart/form-data; boundary=xyz", multipartBody)
+	require.NoError(t, r.ParseMultipartForm(0))
+	_, fh, err = r.FormFile("photo")
+	require.NoError(t, err)
+	tmp, err := fh.Open()
+	require.NoError(t, err)
+	name := tmp.(*os.File).Name()
+	tmp.Close()
+	_, err = os.Stat(name)
+	require.NoError(t, err)
+	require.NoError(t, r.RemoveFormFiles())
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Streaming parts
+	r = formRequest(t, "/upload", "multipart/form-data; boundary=xyz", multipartBody)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", part.FormName())
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "beach.txt", part.FileName())
+	_, err = r.MultipartReader()
+	require.ErrorIs(t, err, ErrMultipartStarted)
+
+	// Test: Not multipart
+	r = formRequest(t, "/upload", "application/x-www-form-urlencoded", "a=b")
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrNotMultipart)
+	r = formRequest(t, "/upload", "multipart/form-data", multipartBody)
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrMissingBoundary)
+}
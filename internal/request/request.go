@@ -5,26 +5,100 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"mime/multipart"
+	"net/url"
 	"strings"
 
 	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
 )
 
 const (
-	bufferSize                 = 8
-	CRLF                       = "\r\n"
-	requestStateInitialized    = 0
-	requestStateDone           = 1
-	requestStateParsingHeaders = 2
-	requestStateParsingBody    = 3
+	bufferSize                      = 8
+	CRLF                            = "\r\n"
+	requestStateInitialized         = 0
+	requestStateDone                = 1
+	requestStateParsingHeaders      = 2
+	requestStateParsingBody         = 3
+	requestStateParsingChunkSize    = 4
+	requestStateParsingChunkData    = 5
+	requestStateParsingChunkDataEnd = 6
+	requestStateParsingTrailers     = 7
 )
 
+var (
+	ErrRequestLineTooLong = errors.New("request line too long")
+	ErrHeadersTooLarge    = errors.New("request header fields too large")
+	ErrBodyTooLarge       = errors.New("request body too large")
+	// ErrVersionNotSupported is returned for well-formed HTTP versions other
+	// than 1.0 and 1.1, such as "HTTP/2.0".
+	ErrVersionNotSupported = errors.New("unsupported version of http")
+	ErrExpectationFailed   = errors.New("unsupported expectation")
+	// ErrUnsupportedTransferEncoding is returned when Transfer-Encoding is
+	// anything but a single "chunked"; other codings are not decoded.
+	ErrUnsupportedTransferEncoding = errors.New("unsupported transfer-encoding")
+)
+
+// Limits bounds how much of a request the parser accepts. Zero fields fall
+// back to DefaultLimits; a negative MaxBodyBytes disables the body limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int64
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxRequestLineBytes: 8 * 1024,
+		MaxHeaderBytes:      64 * 1024,
+		MaxHeaderCount:      100,
+		MaxBodyBytes:        10 * 1024 * 1024,
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits()
+	if l.MaxRequestLineBytes == 0 {
+		l.MaxRequestLineBytes = d.MaxRequestLineBytes
+	}
+	if l.MaxHeaderBytes == 0 {
+		l.MaxHeaderBytes = d.MaxHeaderBytes
+	}
+	if l.MaxHeaderCount == 0 {
+		l.MaxHeaderCount = d.MaxHeaderCount
+	}
+	if l.MaxBodyBytes == 0 {
+		l.MaxBodyBytes = d.MaxBodyBytes
+	}
+	return l
+}
+
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	state       int
+	Target      Target
+	Headers     *headers.Headers
+	// Body is only filled by RequestFromReader or ReadBody. Handlers that
+	// want to stream should read from BodyReader instead.
+	Body       []byte
+	BodyReader io.ReadCloser
+	Trailers   *headers.Headers
+	// Form, PostForm and MultipartForm are only filled by ParseForm and
+	// ParseMultipartForm.
+	Form          url.Values
+	PostForm      url.Values
+	MultipartForm *multipart.Form
+	state         int
+
+	pathValues          map[string]string
+	limits              Limits
+	headerBytes         int
+	headerCount         int
+	bodyBytesRemaining  int
+	chunkBytesRemaining int
+	chunkedBodyBytes    int64
+	expectContinue      bool
+	continueFunc        func() error
+	multipartStarted    bool
 }
 
 type RequestLine struct {
@@ -33,44 +107,257 @@ type RequestLine struct {
 	Method        string
 }
 
+type Reader struct {
+	Limits Limits
+
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	body        *body
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, bufferSize),
+	}
+}
+
+// RequestFromReader parses a single request and buffers its whole body into
+// Request.Body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
+	r, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadRequest parses the request line and headers of the next request from the
+// underlying reader. The body is not read; it is decoded lazily from the same
+// reader through Request.BodyReader and must be consumed (or discarded with
+// DiscardBody) before the next call. Bytes read past the end of the request are
+// kept for the following call, so a Reader can be reused for every request on
+// a persistent connection. io.EOF is returned as-is when the reader ends before
+// the first byte of a new request.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if rr.body != nil && rr.body.req.state != requestStateDone {
+		return nil, errors.New("previous request body was not fully read")
+	}
 
 	r := Request{
-		Headers: map[string]string{},
-		state:   requestStateInitialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		state:    requestStateInitialized,
+		limits:   rr.Limits.withDefaults(),
 	}
 
-	for r.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	for {
+		numBytesParsed, err := r.parse(rr.buf[:rr.readToIndex])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing request from reader: %w", err)
 		}
+		rr.discard(numBytesParsed)
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
+		if r.state != requestStateInitialized && r.state != requestStateParsingHeaders {
+			break
+		}
+
+		err = rr.fill()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				if r.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", r.state, numBytesRead)
+				if r.state == requestStateInitialized && rr.readToIndex == 0 {
+					return nil, io.EOF
 				}
-				break
+				return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", r.state, rr.readToIndex)
 			}
 			return nil, err
 		}
-		readToIndex += numBytesRead
+	}
 
-		numBytesParsed, err := r.parse(buf[:readToIndex])
+	rr.body = &body{req: &r, reader: rr}
+	r.BodyReader = rr.body
+	return &r, nil
+}
+
+// WaitForRequest blocks until at least one byte of the next request is
+// available, so callers can time the idle period separately from the request.
+func (rr *Reader) WaitForRequest() error {
+	for rr.readToIndex == 0 {
+		err := rr.fill()
 		if err != nil {
-			return nil, fmt.Errorf("error parsing request from reader: %v", err)
+			return err
 		}
+	}
+	return nil
+}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+func (rr *Reader) fill() error {
+	if rr.readToIndex >= len(rr.buf) {
+		newBuf := make([]byte, len(rr.buf)*2)
+		copy(newBuf, rr.buf)
+		rr.buf = newBuf
 	}
 
-	return &r, nil
+	numBytesRead, err := rr.reader.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += numBytesRead
+	if numBytesRead > 0 {
+		return nil
+	}
+	return err
+}
+
+func (rr *Reader) discard(n int) {
+	copy(rr.buf, rr.buf[n:rr.readToIndex])
+	rr.readToIndex -= n
+}
+
+// ReadBody reads the rest of the body into Body and returns it.
+func (r *Request) ReadBody() ([]byte, error) {
+	b, err := io.ReadAll(r.BodyReader)
+	r.Body = append(r.Body, b...)
+	if err != nil {
+		return nil, err
+	}
+	return r.Body, nil
+}
+
+// DiscardBody reads and throws away whatever the handler left unread, even if
+// BodyReader was closed, so the connection can move on to the next request.
+// It gives up with an error after 256 KiB; the connection should then be
+// closed instead.
+func (r *Request) DiscardBody() error {
+	b, ok := r.BodyReader.(*body)
+	if !ok {
+		return nil
+	}
+	buf := make([]byte, discardBufferSize)
+	discarded := 0
+	for {
+		n, err := b.read(buf)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		discarded += n
+		if discarded > maxDiscardBytes {
+			return errors.New("unread request body too large to discard")
+		}
+	}
+}
+
+// BodyErr returns the error that stopped reading the body, if any, such as
+// ErrBodyTooLarge.
+func (r *Request) BodyErr() error {
+	b, ok := r.BodyReader.(*body)
+	if !ok {
+		return nil
+	}
+	return b.err
+}
+
+// PathValue returns the value of a named path parameter set by a router, or an
+// empty string if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// LookupPathValue is like PathValue but also reports whether the parameter was
+// set, to tell an empty value from a missing one.
+func (r *Request) LookupPathValue(name string) (string, bool) {
+	value, ok := r.pathValues[name]
+	return value, ok
+}
+
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = map[string]string{}
+	}
+	r.pathValues[name] = value
+}
+
+// SetContinueFunc sets the function that sends the interim "100 Continue"
+// response. If the client sent "Expect: 100-continue", fn is called once, the
+// first time the body is read before any of it has arrived.
+func (r *Request) SetContinueFunc(fn func() error) {
+	r.continueFunc = fn
+}
+
+// ContinuePending reports whether the client is still waiting for "100
+// Continue" before sending the body, i.e. the handler never read it.
+func (r *Request) ContinuePending() bool {
+	return r.expectContinue && r.state != requestStateDone
+}
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.1 connections are persistent unless the client
+// sends "Connection: close"; HTTP/1.0 ones only with "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	if r.Headers.ContainsToken("Connection", "close") {
+		return false
+	}
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.ContainsToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// Host returns the host the request is addressed to. The authority of an
+// absolute-form or authority-form target takes precedence over the Host header
+// (RFC 9112, section 3.2.2).
+func (r *Request) Host() string {
+	if r.Target.Host != "" {
+		return r.Target.Host
+	}
+	return r.Headers.Get("Host")
+}
+
+// validateHost checks the request carries at most one valid Host header.
+// HTTP/1.1 requests must have one; HTTP/1.0 predates it.
+func (r *Request) validateHost() error {
+	hosts := r.Headers.Values("Host")
+	switch {
+	case len(hosts) == 0:
+		if r.RequestLine.HttpVersion == "1.0" {
+			return nil
+		}
+		return errors.New("missing Host header")
+	case len(hosts) > 1:
+		return errors.New("multiple Host headers")
+	case !isValidHost(hosts[0]):
+		return fmt.Errorf("invalid Host header: %s", hosts[0])
+	}
+	return nil
+}
+
+// parseExpect handles the Expect header. "100-continue" is the only expectation
+// defined (RFC 9110, section 10.1.1); HTTP/1.0 clients cannot send it.
+func (r *Request) parseExpect() error {
+	expect := r.Headers.Get("Expect")
+	if expect == "" || r.RequestLine.HttpVersion == "1.0" {
+		return nil
+	}
+	if !strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return fmt.Errorf("%w: %s", ErrExpectationFailed, expect)
+	}
+	r.expectContinue = true
+	return nil
+}
+
+func isValidHost(s string) bool {
+	for _, c := range []byte(s) {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && !strings.ContainsRune("-._~%!$&'()*+,;=:[]", rune(c)) {
+			return false
+		}
+	}
+	return true
 }
 
 func parseRequestLine(data []byte) (parsedLine *RequestLine, numBytesParsed int, err error) {
@@ -86,26 +373,18 @@ func parseRequestLine(data []byte) (parsedLine *RequestLine, numBytesParsed int,
 		return nil, 0, errors.New("invalid request line")
 	}
 
-	if parts[0] != "GET" &&
-		parts[0] != "POST" &&
-		parts[0] != "PUT" &&
-		parts[0] != "PATCH" &&
-		parts[0] != "DELETE" {
+	// Any token is a valid method (RFC 9110, section 9.1); unknown methods are
+	// left for the handler to reject.
+	if !isToken(parts[0]) {
 		return nil, 0, errors.New("invalid request method")
 	}
 
-	if parts[1][0] != '/' {
-		return nil, 0, errors.New("invalid request target")
-	}
-
-	if !strings.HasPrefix(parts[2], "HTTP/") {
+	version, found := strings.CutPrefix(parts[2], "HTTP/")
+	if !found || !isVersion(version) {
 		return nil, 0, errors.New("invalid request line")
 	}
-
-	version := strings.Split(parts[2], "/")[1]
-
-	if version != "1.1" {
-		return nil, 0, errors.New("unsupported version of http")
+	if version != "1.0" && version != "1.1" {
+		return nil, 0, ErrVersionNotSupported
 	}
 
 	return &RequestLine{
@@ -115,9 +394,35 @@ func parseRequestLine(data []byte) (parsedLine *RequestLine, numBytesParsed int,
 	}, endIndex + 2, nil
 }
 
+// isVersion reports whether s looks like an HTTP version number: a digit,
+// optionally followed by a dot and another digit.
+func isVersion(s string) bool {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	switch len(s) {
+	case 1:
+		return isDigit(s[0])
+	case 3:
+		return isDigit(s[0]) && s[1] == '.' && isDigit(s[2])
+	}
+	return false
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
-	for r.state != requestStateDone {
+	for r.state == requestStateInitialized || r.state == requestStateParsingHeaders {
 		numBytesParsed, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
@@ -136,13 +441,24 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case requestStateInitialized:
 		reqLine, numBytesParsed, err := parseRequestLine(data)
 		if err != nil {
-			return 0, fmt.Errorf("error parsing request line: %v", err)
+			return 0, fmt.Errorf("error parsing request line: %w", err)
 		}
 		if numBytesParsed == 0 {
+			if len(data) > r.limits.MaxRequestLineBytes {
+				return 0, ErrRequestLineTooLong
+			}
 			// need more data
 			return 0, nil
 		}
+		if numBytesParsed-2 > r.limits.MaxRequestLineBytes {
+			return 0, ErrRequestLineTooLong
+		}
+		target, err := parseTarget(reqLine.Method, reqLine.RequestTarget)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing request target: %v", err)
+		}
 		r.RequestLine = *reqLine
+		r.Target = *target
 		r.state = requestStateParsingHeaders
 		return numBytesParsed, nil
 	case requestStateParsingHeaders:
@@ -150,33 +466,47 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
-		if done {
-			r.state = requestStateParsingBody
-		}
-		return numBytesParsed, nil
-	case requestStateParsingBody:
-		contentLength := r.Headers.Get("Content-Length")
-		if contentLength == "" {
-			// Content-length header does not exist. Nothing to parse.
-			r.state = requestStateDone
-			return 0, nil
-		}
-		n, err := strconv.Atoi(contentLength)
+		err = r.checkHeaderLimits(len(data), numBytesParsed, done)
 		if err != nil {
-			return 0, errors.New("error: unable to convert content-length string to int")
-		}
-
-		r.Body = append(r.Body, data...)
-		if len(r.Body) > n {
-			return 0, errors.New("error: length of body is greater than size specified by content-length header")
+			return 0, err
 		}
-		if len(r.Body) == n {
-			r.state = requestStateDone
+		if done {
+			err = r.validateHost()
+			if err != nil {
+				return 0, err
+			}
+			err = r.parseExpect()
+			if err != nil {
+				return 0, err
+			}
+			err = r.beginBody()
+			if err != nil {
+				return 0, err
+			}
 		}
-		return len(data), nil
+		return numBytesParsed, nil
 	case requestStateDone:
 		return 0, errors.New("error: trying to read data in a done state")
 	default:
 		return 0, errors.New("unknown state")
 	}
 }
+
+// checkHeaderLimits accounts for one call to Headers.Parse. Trailers share the
+// same budget as the headers.
+func (r *Request) checkHeaderLimits(dataLen, numBytesParsed int, done bool) error {
+	r.headerBytes += numBytesParsed
+	if numBytesParsed == 0 && r.headerBytes+dataLen > r.limits.MaxHeaderBytes {
+		return ErrHeadersTooLarge
+	}
+	if r.headerBytes > r.limits.MaxHeaderBytes {
+		return ErrHeadersTooLarge
+	}
+	if numBytesParsed > 0 && !done {
+		r.headerCount++
+		if r.headerCount > r.limits.MaxHeaderCount {
+			return ErrHeadersTooLarge
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package request
 
 import (
+	"errors"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -86,6 +88,42 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 
+	// Test: HEAD and extension methods
+	for _, method := range []string{"HEAD", "OPTIONS", "TRACE", "PROPFIND"} {
+		reader = &chunkReader{
+			data:            method + " /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		r, err = RequestFromReader(reader)
+		require.NoError(t, err)
+		assert.Equal(t, method, r.RequestLine.Method)
+	}
+
+	// Test: Asterisk-form target for OPTIONS
+	reader = &chunkReader{
+		data:            "OPTIONS * HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "*", r.RequestLine.RequestTarget)
+
+	// Test: Asterisk-form target for other methods
+	reader = &chunkReader{
+		data:            "GET * HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Method that is not a token
+	reader = &chunkReader{
+		data:            "G(E)T /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
 	// Test: Invalid version in request line
 	reader = &chunkReader{
 		data:            "OPTIONS /prime/rib TCP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -104,19 +142,17 @@ func TestHeadersParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 	// Test: Empty headers
 	reader = &chunkReader{
 		data:            "GET / HTTP/1.1\r\n\r\n",
 		numBytesPerRead: 3,
 	}
-	r, err = RequestFromReader(reader)
-	require.NoError(t, err)
-	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
 
 	// Test: Malformed header
 	reader = &chunkReader{
@@ -128,13 +164,13 @@ func TestHeadersParse(t *testing.T) {
 
 	// Test: Duplicate headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: duplicate:8080\r\n\r\n",
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nAccept: text/html\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, duplicate:8080", r.Headers["host"])
+	assert.Equal(t, "text/html, */*", r.Headers.Get("accept"))
 
 	// Test: Case-insensitive headers
 	reader = &chunkReader{
@@ -144,8 +180,8 @@ func TestHeadersParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
 
 	// Test: Missing end of headers
 	reader = &chunkReader{
@@ -221,4 +257,547 @@ func TestBodyParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
+
+	// Test: Signed or padded content length is rejected
+	for _, contentLength := range []string{"+5", "-5", "5 5", "0x5"} {
+		reader = &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Content-Length: " + contentLength + "\r\n" +
+				"\r\n" +
+				"hello",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.Error(t, err, contentLength)
+	}
+}
+
+func TestPersistentConnection(t *testing.T) {
+	// Test: Pipelined requests on one reader
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean EOF between requests
+	r, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, r)
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7;name=value\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, 0, r.Trailers.Len())
+
+	// Test: Chunked body with trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"A\r\n" +
+			"0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", string(r.Body))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Both transfer-encoding and content-length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Codings other than chunked are rejected
+	for _, transferEncoding := range []string{"gzip, chunked", "gzip", "chunked, chunked"} {
+		reader = &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: " + transferEncoding + "\r\n" +
+				"\r\n" +
+				"3\r\n" +
+				"abc\r\n" +
+				"0\r\n" +
+				"\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrUnsupportedTransferEncoding)
+	}
+}
+
+func TestBodyReader(t *testing.T) {
+	// Test: Body is streamed, not buffered
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Nil(t, r.Body)
+	buf := make([]byte, 5)
+	n, err := io.ReadFull(r.BodyReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	rest, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, " world!\n", string(rest))
+
+	// Test: Unread body is discarded before the next request
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(buf)
+	require.Error(t, err)
+	_, err = reader.ReadRequest()
+	require.Error(t, err)
+	require.NoError(t, r.DiscardBody())
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+
+	// Test: Discarding a large unread body gives up
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 300000\r\n" +
+			"\r\n" +
+			strings.Repeat("a", 300000),
+		numBytesPerRead: 4096,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.Error(t, r.DiscardBody())
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      2,
+		MaxBodyBytes:        8,
+	}
+
+	// Test: Request line too long
+	reader := NewReader(&chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err := reader.ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Header section too large
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Padding: " + strings.Repeat("a", 64) + "\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Too many header fields
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nA: 1\r\nB: 2\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Content-Length over the body limit
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 9\r\n\r\n123456789",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	require.ErrorIs(t, r.BodyErr(), ErrBodyTooLarge)
+
+	// Test: Body within limits
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 8\r\n\r\n12345678",
+		numBytesPerRead: 3,
+	})
+	reader.Limits = limits
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(body))
+}
+
+func TestRequestTargetParse(t *testing.T) {
+	// Test: Origin-form with decoded path and query
+	reader := &chunkReader{
+		data:            "GET /caf%C3%A9/a%2Fb?q=go+lang&tag=a&tag=b HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormOrigin, r.Target.Form)
+	assert.Equal(t, "/café/a/b", r.Target.Path)
+	assert.Equal(t, "/caf%C3%A9/a%2Fb", r.Target.RawPath)
+	assert.Equal(t, "q=go+lang&tag=a&tag=b", r.Target.RawQuery)
+	assert.Equal(t, "go lang", r.Target.Query.Get("q"))
+	assert.Equal(t, []string{"a", "b"}, r.Target.Query["tag"])
+
+	// Test: Absolute-form
+	reader = &chunkReader{
+		data:            "GET http://example.com:8080/coffee?size=large HTTP/1.1\r\nHost: example.com:8080\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormAbsolute, r.Target.Form)
+	assert.Equal(t, "http", r.Target.Scheme)
+	assert.Equal(t, "example.com:8080", r.Target.Host)
+	assert.Equal(t, "/coffee", r.Target.Path)
+	assert.Equal(t, "large", r.Target.Query.Get("size"))
+
+	// Test: Absolute-form without a path
+	reader = &chunkReader{
+		data:            "GET http://example.com HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.Target.Path)
+
+	// Test: Authority-form for CONNECT
+	reader = &chunkReader{
+		data:            "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormAuthority, r.Target.Form)
+	assert.Equal(t, "example.com:443", r.Target.Host)
+
+	// Test: Asterisk-form
+	reader = &chunkReader{
+		data:            "OPTIONS * HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormAsterisk, r.Target.Form)
+
+	// Test: Invalid targets
+	for _, line := range []string{
+		"GET  HTTP/1.1",
+		"GET /coffee#top HTTP/1.1",
+		"GET /caf%zz HTTP/1.1",
+		"GET coffee HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT /coffee HTTP/1.1",
+		"GET http:///coffee HTTP/1.1",
+	} {
+		reader = &chunkReader{
+			data:            line + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.Error(t, err, line)
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	// Test: Host from header
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:42069", r.Host())
+
+	// Test: Absolute-form authority overrides Host header
+	reader = &chunkReader{
+		data:            "GET http://example.com/coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", r.Host())
+
+	// Test: Empty Host header
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: \r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "", r.Host())
+
+	// Test: Missing, duplicate and invalid Host headers
+	for _, h := range []string{
+		"Accept: */*\r\n",
+		"Host: localhost:42069\r\nHost: duplicate:8080\r\n",
+		"Host: localhost/coffee\r\n",
+		"Host: user@localhost\r\n",
+	} {
+		reader = &chunkReader{
+			data:            "GET / HTTP/1.1\r\n" + h + "\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.Error(t, err, h)
+	}
+}
+
+func TestHTTPVersion(t *testing.T) {
+	// Test: HTTP/1.0 without Host
+	reader := &chunkReader{
+		data:            "GET /coffee HTTP/1.0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 with keep-alive
+	reader = &chunkReader{
+		data:            "GET /coffee HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 is persistent by default
+	reader = &chunkReader{
+		data:            "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Unsupported versions
+	for _, version := range []string{"HTTP/2.0", "HTTP/2", "HTTP/3", "HTTP/0.9"} {
+		reader = &chunkReader{
+			data:            "GET /coffee " + version + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+
+	// Test: Malformed versions
+	for _, version := range []string{"HTTP/1.1.1", "HTTP/one", "HTTP/", "HTTP/11"} {
+		reader = &chunkReader{
+			data:            "GET /coffee " + version + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.Error(t, err, version)
+		require.NotErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+}
+
+// continueReader only hands out the body once continued is set, like a client
+// waiting for 100 Continue.
+type continueReader struct {
+	head      string
+	body      string
+	continued bool
+}
+
+func (cr *continueReader) Read(p []byte) (int, error) {
+	if cr.head != "" {
+		n := copy(p, cr.head)
+		cr.head = cr.head[n:]
+		return n, nil
+	}
+	if !cr.continued {
+		return 0, errors.New("body read before 100 Continue")
+	}
+	if cr.body == "" {
+		return 0, io.EOF
+	}
+	n := copy(p, cr.body)
+	cr.body = cr.body[n:]
+	return n, nil
+}
+
+func TestExpectContinue(t *testing.T) {
+	// Test: Continue is sent on the first body read
+	cr := &continueReader{
+		head: "PUT /upload HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n",
+		body: "hello",
+	}
+	r, err := NewReader(cr).ReadRequest()
+	require.NoError(t, err)
+	numContinues := 0
+	r.SetContinueFunc(func() error {
+		numContinues++
+		cr.continued = true
+		return nil
+	})
+	assert.True(t, r.ContinuePending())
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, 1, numContinues)
+	assert.False(t, r.ContinuePending())
+
+	// Test: Continue is not needed for an empty body
+	cr = &continueReader{
+		head: "PUT /upload HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-continue\r\nContent-Length: 0\r\n\r\n",
+	}
+	r, err = NewReader(cr).ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.ContinuePending())
+
+	// Test: Unknown expectation
+	reader := &chunkReader{
+		data:            "PUT /upload HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 200-ok\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrExpectationFailed)
+
+	// Test: Expectation is ignored for HTTP/1.0
+	reader = &chunkReader{
+		data:            "PUT /upload HTTP/1.0\r\nExpect: 200-ok\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
 }
@@ -0,0 +1,116 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+type TargetForm int
+
+// The four forms of request-target from RFC 9112, section 3.2.
+const (
+	TargetFormOrigin TargetForm = iota
+	TargetFormAbsolute
+	TargetFormAuthority
+	TargetFormAsterisk
+)
+
+type Target struct {
+	Form TargetForm
+	// Scheme is only set for the absolute-form.
+	Scheme string
+	// Host is the authority of an absolute-form or authority-form target.
+	Host string
+	// Path is the percent-decoded path; RawPath is the path as it was sent.
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    url.Values
+}
+
+func parseTarget(method, raw string) (*Target, error) {
+	if raw == "" {
+		return nil, errors.New("empty request target")
+	}
+	for _, c := range []byte(raw) {
+		if c <= ' ' || c == 0x7f {
+			return nil, errors.New("request target contains invalid characters")
+		}
+	}
+	if strings.Contains(raw, "#") {
+		return nil, errors.New("request target must not contain a fragment")
+	}
+
+	switch {
+	case raw == "*":
+		if method != "OPTIONS" {
+			return nil, errors.New("asterisk-form is only allowed for OPTIONS")
+		}
+		return &Target{Form: TargetFormAsterisk, Query: url.Values{}}, nil
+	case method == "CONNECT":
+		_, port, err := net.SplitHostPort(raw)
+		if err != nil || port == "" || strings.Contains(raw, "/") {
+			return nil, fmt.Errorf("invalid authority-form target: %s", raw)
+		}
+		return &Target{Form: TargetFormAuthority, Host: raw, Query: url.Values{}}, nil
+	case strings.HasPrefix(raw, "/"):
+		t := &Target{Form: TargetFormOrigin}
+		return t, t.setPathAndQuery(raw)
+	}
+
+	scheme, rest, found := strings.Cut(raw, "://")
+	if !found || !isScheme(scheme) {
+		return nil, fmt.Errorf("invalid request target: %s", raw)
+	}
+	authorityEnd := strings.IndexAny(rest, "/?")
+	if authorityEnd == -1 {
+		authorityEnd = len(rest)
+	}
+	t := &Target{
+		Form:   TargetFormAbsolute,
+		Scheme: strings.ToLower(scheme),
+		Host:   rest[:authorityEnd],
+	}
+	if t.Host == "" || strings.Contains(t.Host, "@") {
+		return nil, fmt.Errorf("invalid authority in request target: %s", raw)
+	}
+	pathAndQuery := rest[authorityEnd:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		pathAndQuery = "/" + pathAndQuery
+	}
+	return t, t.setPathAndQuery(pathAndQuery)
+}
+
+func (t *Target) setPathAndQuery(s string) error {
+	t.RawPath, t.RawQuery, _ = strings.Cut(s, "?")
+	path, err := url.PathUnescape(t.RawPath)
+	if err != nil {
+		return fmt.Errorf("invalid path in request target: %v", err)
+	}
+	t.Path = path
+	query, err := url.ParseQuery(t.RawQuery)
+	if err != nil {
+		return fmt.Errorf("invalid query in request target: %v", err)
+	}
+	t.Query = query
+	return nil
+}
+
+func isScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range []byte(s) {
+		isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if i == 0 && !isAlpha {
+			return false
+		}
+		if !isAlpha && !(c >= '0' && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+)
+
+// ETag formats opaque as an entity tag for the ETag field, e.g. `"v1"` or
+// `W/"v1"` when weak. A weak tag only promises the content is equivalent, not
+// byte for byte identical, so it is never used to serve ranges.
+func ETag(opaque string, weak bool) string {
+	if weak {
+		return `W/"` + opaque + `"`
+	}
+	return `"` + opaque + `"`
+}
+
+type entityTag struct {
+	opaque string
+	weak   bool
+}
+
+// CheckPreconditions evaluates the conditional headers of req against the
+// ETag and Last-Modified fields already set in w.Header(), in the order given
+// by RFC 9110, section 13.2.2. If a precondition stops the request, it writes
+// a 304 Not Modified or 412 Precondition Failed response and returns true; the
+// handler should then return without writing anything else.
+func CheckPreconditions(w *Writer, req *request.Request) bool {
+	h := w.Header()
+	etag, hasETag := parseETag(h.Get("ETag"))
+	lastModified, hasLastModified := parseTime(h.Get("Last-Modified"))
+	isGetOrHead := req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD"
+
+	if ifMatch := req.Headers.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, hasETag, true) {
+			writePreconditionFailed(w)
+			return true
+		}
+	} else if t, ok := parseTime(req.Headers.Get("If-Unmodified-Since")); ok && hasLastModified {
+		if lastModified.After(t) {
+			writePreconditionFailed(w)
+			return true
+		}
+	}
+
+	if ifNoneMatch := req.Headers.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, hasETag, false) {
+			if isGetOrHead {
+				writeNotModified(w)
+			} else {
+				writePreconditionFailed(w)
+			}
+			return true
+		}
+	} else if t, ok := parseTime(req.Headers.Get("If-Modified-Since")); ok && isGetOrHead && hasLastModified {
+		if !lastModified.After(t) {
+			writeNotModified(w)
+			return true
+		}
+	}
+	return false
+}
+
+// etagListMatches reports whether the If-Match or If-None-Match value list
+// matches etag. "*" matches any current representation.
+func etagListMatches(list string, etag entityTag, hasETag, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return hasETag
+	}
+	if !hasETag {
+		return false
+	}
+	for _, tag := range parseETagList(list) {
+		if tag.opaque != etag.opaque {
+			continue
+		}
+		if !strong || (!tag.weak && !etag.weak) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseETag(s string) (entityTag, bool) {
+	tag := entityTag{}
+	if rest, found := strings.CutPrefix(s, "W/"); found {
+		tag.weak = true
+		s = rest
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return entityTag{}, false
+	}
+	tag.opaque = s[1 : len(s)-1]
+	if strings.Contains(tag.opaque, `"`) {
+		return entityTag{}, false
+	}
+	return tag, true
+}
+
+// parseETagList parses a comma separated list of entity tags. Tags may contain
+// commas themselves, so the list is scanned quote by quote; parsing stops at
+// the first malformed tag.
+func parseETagList(s string) []entityTag {
+	var tags []entityTag
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return tags
+		}
+		tag := entityTag{}
+		if rest, found := strings.CutPrefix(s, "W/"); found {
+			tag.weak = true
+			s = rest
+		}
+		if !strings.HasPrefix(s, `"`) {
+			return tags
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end == -1 {
+			return tags
+		}
+		tag.opaque = s[1 : end+1]
+		tags = append(tags, tag)
+		s = s[end+2:]
+	}
+}
+
+func parseTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(TimeFormat, s)
+	return t, err == nil
+}
+
+func writeNotModified(w *Writer) {
+	// A 304 has no body; the fields describing one would be wrong.
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Transfer-Encoding")
+	w.WriteStatusLine(StatusCodeNotModified)
+	w.WriteHeaders(h)
+}
+
+func writePreconditionFailed(w *Writer) {
+	body := []byte("412 precondition failed\n")
+	h := w.Header()
+	h.Overwrite("Content-Type", "text/plain")
+	h.Overwrite("Content-Length", strconv.Itoa(len(body)))
+	w.WriteStatusLine(StatusCodePreconditionFailed)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
@@ -0,0 +1,146 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+)
+
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out, so the browser's default
+	// applies.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a cookie to send with Set-Cookie (RFC 6265, section 4.1).
+type Cookie struct {
+	Name  string
+	Value string
+
+	Domain string
+	Path   string
+	// Expires is left out when zero.
+	Expires time.Time
+	// MaxAge is left out when zero. A negative MaxAge deletes the cookie now
+	// and is sent as "Max-Age=0".
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Valid reports whether the cookie can be serialized.
+func (c *Cookie) Valid() error {
+	if !isToken(c.Name) {
+		return fmt.Errorf("invalid cookie name %q", c.Name)
+	}
+	for _, b := range []byte(c.Value) {
+		if b < 0x20 || b >= 0x7f || b == '"' || b == ';' || b == '\\' {
+			return fmt.Errorf("invalid byte %q in value of cookie %s", b, c.Name)
+		}
+	}
+	if !isAttributeValue(c.Domain) {
+		return fmt.Errorf("invalid Domain for cookie %s", c.Name)
+	}
+	if !isAttributeValue(c.Path) {
+		return fmt.Errorf("invalid Path for cookie %s", c.Name)
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return fmt.Errorf("invalid Expires for cookie %s", c.Name)
+	}
+	if c.Partitioned && !c.Secure {
+		return errors.New("partitioned cookies must be Secure")
+	}
+	return nil
+}
+
+// String returns the cookie serialized as a Set-Cookie value, or an empty
+// string if it is not valid.
+func (c *Cookie) String() string {
+	if c.Valid() != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteString("=")
+	if strings.ContainsAny(c.Value, " ,") {
+		b.WriteString(`"` + c.Value + `"`)
+	} else {
+		b.WriteString(c.Value)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// SetCookie adds c to h as its own Set-Cookie field.
+func SetCookie(h *headers.Headers, c *Cookie) error {
+	err := c.Valid()
+	if err != nil {
+		return err
+	}
+	h.Add("Set-Cookie", c.String())
+	return nil
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAttributeValue(s string) bool {
+	for _, c := range []byte(s) {
+		if c < 0x20 || c >= 0x7f || c == ';' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,37 +1,176 @@
 package response
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
 )
 
+// TimeFormat is the format of dates in HTTP fields such as Expires and
+// Last-Modified (RFC 9110, section 5.6.7). Times must be in UTC.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
 type StatusCode int
 
+// Status codes registered with IANA, as defined by RFC 9110 and its extensions.
 const (
-	StatusCodeOK                  StatusCode = 200
-	StatusCodeBadRequest          StatusCode = 400
-	StatusCodeInternalServerError StatusCode = 500
+	StatusCodeContinue           StatusCode = 100
+	StatusCodeSwitchingProtocols StatusCode = 101
+	StatusCodeProcessing         StatusCode = 102
+	StatusCodeEarlyHints         StatusCode = 103
+
+	StatusCodeOK                          StatusCode = 200
+	StatusCodeCreated                     StatusCode = 201
+	StatusCodeAccepted                    StatusCode = 202
+	StatusCodeNonAuthoritativeInformation StatusCode = 203
+	StatusCodeNoContent                   StatusCode = 204
+	StatusCodeResetContent                StatusCode = 205
+	StatusCodePartialContent              StatusCode = 206
+	StatusCodeMultiStatus                 StatusCode = 207
+	StatusCodeAlreadyReported             StatusCode = 208
+	StatusCodeIMUsed                      StatusCode = 226
+
+	StatusCodeMultipleChoices   StatusCode = 300
+	StatusCodeMovedPermanently  StatusCode = 301
+	StatusCodeFound             StatusCode = 302
+	StatusCodeSeeOther          StatusCode = 303
+	StatusCodeNotModified       StatusCode = 304
+	StatusCodeUseProxy          StatusCode = 305
+	StatusCodeTemporaryRedirect StatusCode = 307
+	StatusCodePermanentRedirect StatusCode = 308
+
+	StatusCodeBadRequest                  StatusCode = 400
+	StatusCodeUnauthorized                StatusCode = 401
+	StatusCodePaymentRequired             StatusCode = 402
+	StatusCodeForbidden                   StatusCode = 403
+	StatusCodeNotFound                    StatusCode = 404
+	StatusCodeMethodNotAllowed            StatusCode = 405
+	StatusCodeNotAcceptable               StatusCode = 406
+	StatusCodeProxyAuthenticationRequired StatusCode = 407
+	StatusCodeRequestTimeout              StatusCode = 408
+	StatusCodeConflict                    StatusCode = 409
+	StatusCodeGone                        StatusCode = 410
+	StatusCodeLengthRequired              StatusCode = 411
+	StatusCodePreconditionFailed          StatusCode = 412
+	StatusCodeContentTooLarge             StatusCode = 413
+	StatusCodeURITooLong                  StatusCode = 414
+	StatusCodeUnsupportedMediaType        StatusCode = 415
+	StatusCodeRangeNotSatisfiable         StatusCode = 416
+	StatusCodeExpectationFailed           StatusCode = 417
+	StatusCodeMisdirectedRequest          StatusCode = 421
+	StatusCodeUnprocessableContent        StatusCode = 422
+	StatusCodeLocked                      StatusCode = 423
+	StatusCodeFailedDependency            StatusCode = 424
+	StatusCodeTooEarly                    StatusCode = 425
+	StatusCodeUpgradeRequired             StatusCode = 426
+	StatusCodePreconditionRequired        StatusCode = 428
+	StatusCodeTooManyRequests             StatusCode = 429
+	StatusCodeRequestHeaderFieldsTooLarge StatusCode = 431
+	StatusCodeUnavailableForLegalReasons  StatusCode = 451
+
+	StatusCodeInternalServerError           StatusCode = 500
+	StatusCodeNotImplemented                StatusCode = 501
+	StatusCodeBadGateway                    StatusCode = 502
+	StatusCodeServiceUnavailable            StatusCode = 503
+	StatusCodeGatewayTimeout                StatusCode = 504
+	StatusCodeHTTPVersionNotSupported       StatusCode = 505
+	StatusCodeVariantAlsoNegotiates         StatusCode = 506
+	StatusCodeInsufficientStorage           StatusCode = 507
+	StatusCodeLoopDetected                  StatusCode = 508
+	StatusCodeNotExtended                   StatusCode = 510
+	StatusCodeNetworkAuthenticationRequired StatusCode = 511
 )
 
-func getStatusLine(statusCode StatusCode) []byte {
-	reason := ""
-	switch statusCode {
-	case StatusCodeOK:
-		reason = "OK"
-	case StatusCodeBadRequest:
-		reason = "Bad Request"
-	case StatusCodeInternalServerError:
-		reason = "Internal Server Error"
-	}
+var statusText = map[StatusCode]string{
+	StatusCodeContinue:                      "Continue",
+	StatusCodeSwitchingProtocols:            "Switching Protocols",
+	StatusCodeProcessing:                    "Processing",
+	StatusCodeEarlyHints:                    "Early Hints",
+	StatusCodeOK:                            "OK",
+	StatusCodeCreated:                       "Created",
+	StatusCodeAccepted:                      "Accepted",
+	StatusCodeNonAuthoritativeInformation:   "Non-Authoritative Information",
+	StatusCodeNoContent:                     "No Content",
+	StatusCodeResetContent:                  "Reset Content",
+	StatusCodePartialContent:                "Partial Content",
+	StatusCodeMultiStatus:                   "Multi-Status",
+	StatusCodeAlreadyReported:               "Already Reported",
+	StatusCodeIMUsed:                        "IM Used",
+	StatusCodeMultipleChoices:               "Multiple Choices",
+	StatusCodeMovedPermanently:              "Moved Permanently",
+	StatusCodeFound:                         "Found",
+	StatusCodeSeeOther:                      "See Other",
+	StatusCodeNotModified:                   "Not Modified",
+	StatusCodeUseProxy:                      "Use Proxy",
+	StatusCodeTemporaryRedirect:             "Temporary Redirect",
+	StatusCodePermanentRedirect:             "Permanent Redirect",
+	StatusCodeBadRequest:                    "Bad Request",
+	StatusCodeUnauthorized:                  "Unauthorized",
+	StatusCodePaymentRequired:               "Payment Required",
+	StatusCodeForbidden:                     "Forbidden",
+	StatusCodeNotFound:                      "Not Found",
+	StatusCodeMethodNotAllowed:              "Method Not Allowed",
+	StatusCodeNotAcceptable:                 "Not Acceptable",
+	StatusCodeProxyAuthenticationRequired:   "Proxy Authentication Required",
+	StatusCodeRequestTimeout:                "Request Timeout",
+	StatusCodeConflict:                      "Conflict",
+	StatusCodeGone:                          "Gone",
+	StatusCodeLengthRequired:                "Length Required",
+	StatusCodePreconditionFailed:            "Precondition Failed",
+	StatusCodeContentTooLarge:               "Content Too Large",
+	StatusCodeURITooLong:                    "URI Too Long",
+	StatusCodeUnsupportedMediaType:          "Unsupported Media Type",
+	StatusCodeRangeNotSatisfiable:           "Range Not Satisfiable",
+	StatusCodeExpectationFailed:             "Expectation Failed",
+	StatusCodeMisdirectedRequest:            "Misdirected Request",
+	StatusCodeUnprocessableContent:          "Unprocessable Content",
+	StatusCodeLocked:                        "Locked",
+	StatusCodeFailedDependency:              "Failed Dependency",
+	StatusCodeTooEarly:                      "Too Early",
+	StatusCodeUpgradeRequired:               "Upgrade Required",
+	StatusCodePreconditionRequired:          "Precondition Required",
+	StatusCodeTooManyRequests:               "Too Many Requests",
+	StatusCodeRequestHeaderFieldsTooLarge:   "Request Header Fields Too Large",
+	StatusCodeUnavailableForLegalReasons:    "Unavailable For Legal Reasons",
+	StatusCodeInternalServerError:           "Internal Server Error",
+	StatusCodeNotImplemented:                "Not Implemented",
+	StatusCodeBadGateway:                    "Bad Gateway",
+	StatusCodeServiceUnavailable:            "Service Unavailable",
+	StatusCodeGatewayTimeout:                "Gateway Timeout",
+	StatusCodeHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusCodeVariantAlsoNegotiates:         "Variant Also Negotiates",
+	StatusCodeInsufficientStorage:           "Insufficient Storage",
+	StatusCodeLoopDetected:                  "Loop Detected",
+	StatusCodeNotExtended:                   "Not Extended",
+	StatusCodeNetworkAuthenticationRequired: "Network Authentication Required",
+}
+
+// StatusText returns the standard reason phrase for statusCode, or an empty
+// string if the code is not registered.
+func StatusText(statusCode StatusCode) string {
+	return statusText[statusCode]
+}
+
+func getStatusLine(statusCode StatusCode, reason string) []byte {
 	statusLine := fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reason)
 	return []byte(statusLine)
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func validateStatus(statusCode StatusCode, reason string) error {
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("invalid status code %d", statusCode)
+	}
+	if strings.ContainsAny(reason, "\r\n") {
+		return errors.New("reason phrase must not contain CR or LF")
+	}
+	return nil
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
 	h.Set("Content-Length", fmt.Sprintf("%d", contentLen))
-	h.Set("Connection", "close")
 	h.Set("Content-Type", "text/plain")
 	return h
 }
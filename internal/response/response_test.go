@@ -0,0 +1,463 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Standard reason phrase
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	err := w.WriteStatusLine(StatusCodeNotFound)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+
+	// Test: Unregistered status code has an empty reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	err = w.WriteStatusLine(StatusCode(299))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 299 \r\n", buf.String())
+
+	// Test: Custom reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	err = w.WriteStatusLineWithReason(StatusCodeOK, "Totally Fine")
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", buf.String())
+
+	// Test: Reason phrase with CRLF is rejected
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	err = w.WriteStatusLineWithReason(StatusCodeOK, "OK\r\nX-Injected: yes")
+	require.Error(t, err)
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+
+	// Test: Invalid status code is rejected
+	w = NewWriter(&bytes.Buffer{})
+	err = w.WriteStatusLine(StatusCode(42))
+	require.Error(t, err)
+}
+
+func TestBufferedBody(t *testing.T) {
+	// Test: Content-Length is computed when the handler leaves it out
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err := w.WriteBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("world"))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\n\r\nhello world", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Switches to chunked encoding past the buffer size
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.SetBufferSize(8)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.WriteBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n", buf.String())
+	assert.Equal(t, 11, w.BytesWritten())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Without buffering the body is delimited by closing the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.SetBufferSize(0)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Short body with explicit Content-Length closes the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestImplicitHead(t *testing.T) {
+	// Test: First Write sends a 200 with the headers from Header
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]string{"hello": "world"})
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, "%d\n", 42)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 21\r\n\r\n{\"hello\":\"world\"}\n42\n", buf.String())
+
+	// Test: Explicit status line keeps Header fields
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Location", "/new")
+	require.NoError(t, w.WriteStatusLine(StatusCodeCreated))
+	_, err = io.Copy(w, strings.NewReader("created"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 201 Created\r\nLocation: /new\r\nContent-Length: 7\r\n\r\ncreated", buf.String())
+
+	// Test: Headers passed to WriteHeaders take precedence over Header
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("X-Extra", "1")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\nX-Extra: 1\r\n\r\n", buf.String())
+
+	// Test: Write frames chunks when the handler asked for chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, " %s", "world")
+	require.NoError(t, err)
+	_, err = io.Copy(w, strings.NewReader("!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n1\r\n!\r\n0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Nothing written sends an empty 200
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestBodyNotAllowed(t *testing.T) {
+	// Test: Body bytes for a 204 are rejected and the connection stays usable
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNoContent))
+	_, err := w.Write([]byte("oops"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.WriteChunkedBody([]byte("oops"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.ReadFrom(strings.NewReader("oops"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Same for a 304
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNotModified))
+	require.NoError(t, w.WriteHeaders(nil))
+	_, err = w.WriteBody([]byte("oops"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n\r\n", buf.String())
+}
+
+func TestHeadResponse(t *testing.T) {
+	req, err := request.RequestFromReader(strings.NewReader("HEAD / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Body is suppressed but Content-Length is kept
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequest(req)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Computed Content-Length counts the suppressed body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequest(req)
+	w.SetKeepAlive(true)
+	w.SetBufferSize(4)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\n\r\n", buf.String())
+}
+
+func TestHTTP10Response(t *testing.T) {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Keep-alive is announced to HTTP/1.0 clients
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequest(req)
+	w.SetKeepAlive(req.KeepAlive())
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nhello", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Large bodies are delimited by closing the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequest(req)
+	w.SetKeepAlive(req.KeepAlive())
+	w.SetBufferSize(4)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello world", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Explicit chunked encoding is dropped
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequest(req)
+	w.SetKeepAlive(req.KeepAlive())
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(h))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriteContinue(t *testing.T) {
+	// Test: Interim response is flushed before the final one
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteContinue())
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", buf.String())
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n"))
+
+	// Test: Skipped once the final status line is written
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteContinue())
+	require.NoError(t, w.Finish())
+	assert.NotContains(t, buf.String(), "100 Continue")
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: All attributes
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Domain:      ".example.com",
+		Path:        "/app",
+		Expires:     time.Date(2030, time.January, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteStrict,
+		Partitioned: true,
+	}
+	assert.Equal(t, "session=abc123; Domain=example.com; Path=/app; Expires=Wed, 02 Jan 2030 02:04:05 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Strict; Partitioned", c.String())
+
+	// Test: Deleting a cookie and quoting values
+	c = &Cookie{Name: "lang", Value: "en US", MaxAge: -1, SameSite: SameSiteLax}
+	assert.Equal(t, `lang="en US"; Max-Age=0; SameSite=Lax`, c.String())
+
+	// Test: Invalid cookies
+	for _, c := range []*Cookie{
+		{Name: "bad name", Value: "x"},
+		{Name: "quote", Value: `a"b`},
+		{Name: "path", Value: "x", Path: "/a;b"},
+		{Name: "partitioned", Value: "x", Partitioned: true},
+	} {
+		require.Error(t, c.Valid(), c.Name)
+		assert.Equal(t, "", c.String())
+	}
+
+	// Test: Each cookie is its own header line
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.SetCookie(&Cookie{Name: "a", Value: "1"}))
+	require.NoError(t, w.SetCookie(&Cookie{Name: "b", Value: "2", HttpOnly: true}))
+	require.Error(t, w.SetCookie(&Cookie{Name: "", Value: "3"}))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2; HttpOnly\r\nContent-Length: 0\r\n\r\n", buf.String())
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	check := func(method, conditions string) (bool, string) {
+		req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost:42069\r\n" + conditions + "\r\n"))
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.SetRequest(req)
+		w.Header().Set("ETag", ETag("v2", false))
+		w.Header().Set("Last-Modified", "Fri, 01 Mar 2024 12:00:00 GMT")
+		w.Header().Set("Content-Type", "text/plain")
+		done := CheckPreconditions(w, req)
+		require.NoError(t, w.Finish())
+		return done, buf.String()
+	}
+
+	assert.Equal(t, `"v1"`, ETag("v1", false))
+	assert.Equal(t, `W/"v1"`, ETag("v1", true))
+
+	// Test: No conditions
+	done, _ := check("GET", "")
+	assert.False(t, done)
+
+	// Test: If-None-Match uses weak comparison
+	for _, ifNoneMatch := range []string{`"v2"`, `W/"v2"`, `"v1", "v2"`, `"a,b", W/"v2"`, `*`} {
+		done, resp := check("GET", "If-None-Match: "+ifNoneMatch+"\r\n")
+		assert.True(t, done, ifNoneMatch)
+		assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nEtag: \"v2\"\r\nLast-Modified: Fri, 01 Mar 2024 12:00:00 GMT\r\nConnection: close\r\n\r\n", resp)
+	}
+	done, _ = check("GET", "If-None-Match: \"v1\"\r\n")
+	assert.False(t, done)
+
+	// Test: If-None-Match on unsafe methods fails the precondition
+	done, resp := check("PUT", "If-None-Match: *\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "HTTP/1.1 412 Precondition Failed\r\n")
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	done, _ = check("GET", "If-None-Match: \"v1\"\r\nIf-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-Modified-Since
+	done, resp = check("GET", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "HTTP/1.1 304 Not Modified\r\n")
+	done, _ = check("GET", "If-Modified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n")
+	assert.False(t, done)
+	done, _ = check("POST", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.False(t, done)
+	done, _ = check("GET", "If-Modified-Since: yesterday\r\n")
+	assert.False(t, done)
+
+	// Test: If-Match uses strong comparison
+	done, _ = check("PUT", "If-Match: \"v1\", \"v2\"\r\n")
+	assert.False(t, done)
+	done, resp = check("PUT", "If-Match: W/\"v2\"\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "HTTP/1.1 412 Precondition Failed\r\n")
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	done, _ = check("PUT", "If-Match: *\r\nIf-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-Unmodified-Since
+	done, resp = check("PUT", "If-Unmodified-Since: Thu, 29 Feb 2024 12:00:00 GMT\r\n")
+	assert.True(t, done)
+	assert.Contains(t, resp, "HTTP/1.1 412 Precondition Failed\r\n")
+	done, _ = check("PUT", "If-Unmodified-Since: Fri, 01 Mar 2024 12:00:00 GMT\r\n")
+	assert.False(t, done)
+}
+
+// readerFromConn stands in for a *net.TCPConn, recording how much was handed
+// to ReadFrom.
+type readerFromConn struct {
+	bytes.Buffer
+	readFromBytes int64
+}
+
+func (c *readerFromConn) ReadFrom(r io.Reader) (int64, error) {
+	n, err := c.Buffer.ReadFrom(r)
+	c.readFromBytes += n
+	return n, err
+}
+
+func TestReadFrom(t *testing.T) {
+	// Test: Unframed body is handed to the connection
+	conn := &readerFromConn{}
+	w := NewWriter(conn)
+	w.SetKeepAlive(true)
+	h := GetDefaultHeaders(11)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	n, err := io.Copy(w, io.LimitReader(strings.NewReader("hello world and more"), 11))
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, int64(11), conn.readFromBytes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nContent-Type: text/plain\r\n\r\nhello world", conn.String())
+	assert.Equal(t, 11, w.BytesWritten())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunked body is copied and framed
+	conn = &readerFromConn{}
+	w = NewWriter(conn)
+	w.SetBufferSize(4)
+	_, err = io.Copy(w, strings.NewReader("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, int64(0), conn.readFromBytes)
+	assert.True(t, strings.HasSuffix(conn.String(), "\r\n\r\nb\r\nhello world\r\n0\r\n\r\n"), conn.String())
+
+	// Test: HEAD only counts the body
+	req, err := request.RequestFromReader(strings.NewReader("HEAD / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	conn = &readerFromConn{}
+	w = NewWriter(conn)
+	w.SetRequest(req)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(11)))
+	n, err = w.ReadFrom(strings.NewReader("hello world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, int64(0), conn.readFromBytes)
+	assert.True(t, strings.HasSuffix(conn.String(), "\r\n\r\n"))
+}
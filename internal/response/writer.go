@@ -1,12 +1,27 @@
 package response
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
 )
 
+const (
+	outputBufferSize  = 4 * 1024
+	copyBufferSize    = 32 * 1024
+	DefaultBufferSize = 32 * 1024
+)
+
+// ErrBodyNotAllowed is returned when writing body bytes to a 1xx, 204 or 304
+// response, which must not have a body.
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
 type writerState int
 
 const (
@@ -14,33 +29,280 @@ const (
 	writerStateHeaders
 	writerStateBody
 	writerStateTrailers
+	writerStateDone
+	writerStateAborted
 )
 
 type Writer struct {
-	writerState writerState
-	writer      io.Writer
+	writerState      writerState
+	dst              io.Writer
+	writer           *bufio.Writer
+	statusCode       StatusCode
+	keepAlive        bool
+	head             bool
+	http10           bool
+	chunked          bool
+	contentLength    int
+	bodyBytesWritten int
+	onWriteHeaders   []func(h *headers.Headers)
+	handlerHeader    *headers.Headers
+	filter           io.WriteCloser
+
+	// When the handler sends headers without Content-Length or
+	// Transfer-Encoding, the headers and up to bufferSize bytes of body are
+	// held back so Finish can fill in Content-Length. Past that the writer
+	// switches to chunked encoding and frames WriteBody calls itself.
+	bufferSize  int
+	buffering   bool
+	autoChunked bool
+	header      *headers.Headers
+	body        bytes.Buffer
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		writerState: writerStateStatusLine,
-		writer:      w,
+		writerState:   writerStateStatusLine,
+		dst:           w,
+		writer:        bufio.NewWriterSize(w, outputBufferSize),
+		contentLength: -1,
+		bufferSize:    DefaultBufferSize,
 	}
 }
 
+// SetKeepAlive sets whether the connection may be reused once the response
+// is complete. When false, a "Connection: close" header is sent.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// KeepAlive reports whether the connection may be reused. It is only
+// meaningful after Finish.
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive
+}
+
+// SetRequest tells the Writer which request it is answering. For HEAD
+// requests, body bytes are counted but not sent, so Content-Length still
+// matches what a GET would return. HTTP/1.0 clients do not understand chunked
+// encoding, so chunked bodies are sent unframed and delimited by closing the
+// connection instead.
+func (w *Writer) SetRequest(req *request.Request) {
+	w.head = req.RequestLine.Method == "HEAD"
+	w.http10 = req.RequestLine.HttpVersion == "1.0"
+}
+
+// SetBufferSize sets how many body bytes are buffered to compute
+// Content-Length when the handler does not provide one. Zero or less turns
+// buffering off, in which case such bodies are delimited by closing the
+// connection.
+func (w *Writer) SetBufferSize(n int) {
+	w.bufferSize = n
+}
+
+// StatusCode returns the status code written so far, or 0 if the status line
+// has not been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written, excluding chunked
+// framing.
+func (w *Writer) BytesWritten() int {
+	return w.bodyBytesWritten
+}
+
+// OnWriteHeaders registers fn to be called with the response headers right
+// before they are written, giving it a chance to modify them. Functions run in
+// the order they were registered.
+func (w *Writer) OnWriteHeaders(fn func(h *headers.Headers)) {
+	w.onWriteHeaders = append(w.onWriteHeaders, fn)
+}
+
+// Mark is a snapshot of how a response is set up, taken with Writer.Mark.
+type Mark struct {
+	onWriteHeaders int
+	header         *headers.Headers
+}
+
+// Mark records the fields in Header and the OnWriteHeaders functions
+// registered so far, so ResetTo can return to them.
+func (w *Writer) Mark() Mark {
+	return Mark{onWriteHeaders: len(w.onWriteHeaders), header: w.Header().Clone()}
+}
+
+// ResetTo discards whatever was set up for the response since m was taken:
+// Header goes back to its fields at that point, later OnWriteHeaders functions
+// are dropped and so is the body filter. This lets a different response, such
+// as an error page, be written instead. It fails once the status line is
+// written.
+func (w *Writer) ResetTo(m Mark) error {
+	if w.writerState != writerStateStatusLine {
+		return fmt.Errorf("unable to reset response in state %d", w.writerState)
+	}
+	w.onWriteHeaders = w.onWriteHeaders[:min(m.onWriteHeaders, len(w.onWriteHeaders))]
+	w.handlerHeader = m.header.Clone()
+	w.filter = nil
+	return nil
+}
+
+// HeadersSent reports whether the headers have been written out. Headers held
+// back to compute Content-Length are not sent yet, so OnWriteHeaders functions
+// can still change them until then.
+func (w *Writer) HeadersSent() bool {
+	return w.writerState > writerStateHeaders && !w.buffering
+}
+
+// SetBodyFilter routes the body through the writer returned by fn, e.g. to
+// compress it. fn is given the writer for the filtered output, which is framed
+// as usual; the filter is closed before the response is finished and flushed
+// by Flush if it has a Flush method. It must be set before any body is written,
+// typically from an OnWriteHeaders function. Fields describing the body, such
+// as Content-Length, are up to the caller.
+func (w *Writer) SetBodyFilter(fn func(body io.Writer) io.WriteCloser) error {
+	if w.writerState > writerStateHeaders {
+		return fmt.Errorf("unable to set body filter in state %d", w.writerState)
+	}
+	w.filter = fn(filterOutput{w})
+	return nil
+}
+
+// filterOutput receives the output of a body filter.
+type filterOutput struct {
+	w *Writer
+}
+
+func (o filterOutput) Write(p []byte) (int, error) {
+	return o.w.writeBody(p)
+}
+
+// closeFilter flushes whatever the filter still holds into the body.
+func (w *Writer) closeFilter() error {
+	if w.filter == nil {
+		return nil
+	}
+	filter := w.filter
+	w.filter = nil
+	return filter.Close()
+}
+
+// Header returns the headers that will be sent with the response. They can be
+// changed until the headers are written, either explicitly with WriteHeaders
+// or implicitly by the first Write.
+func (w *Writer) Header() *headers.Headers {
+	if w.handlerHeader == nil {
+		w.handlerHeader = headers.NewHeaders()
+	}
+	return w.handlerHeader
+}
+
+// SetCookie adds a Set-Cookie field for c to Header. Like other changes to
+// Header, it has no effect once the headers are written.
+func (w *Writer) SetCookie(c *Cookie) error {
+	return SetCookie(w.Header(), c)
+}
+
+// Write writes p as part of the body, so the Writer can be used anywhere an
+// io.Writer is accepted. If the status line or headers have not been written
+// yet, a 200 status and the headers from Header are written first.
+func (w *Writer) Write(p []byte) (int, error) {
+	err := w.writeImplicitHead()
+	if err != nil {
+		return 0, err
+	}
+	return w.WriteBody(p)
+}
+
+// ReadFrom copies src into the body until EOF, writing the implicit head first
+// like Write. When the body goes out unframed and the destination implements
+// io.ReaderFrom, as *net.TCPConn does, the copy is handed to it after flushing,
+// so an *os.File source is sent with sendfile without passing through user
+// space. Otherwise src is copied through Write.
+func (w *Writer) ReadFrom(src io.Reader) (int64, error) {
+	err := w.writeImplicitHead()
+	if err != nil {
+		return 0, err
+	}
+	if w.writerState != writerStateBody {
+		return 0, fmt.Errorf("unable to write body in state %d", w.writerState)
+	}
+	if !bodyAllowed(w.statusCode) {
+		return 0, ErrBodyNotAllowed
+	}
+
+	rf, ok := w.dst.(io.ReaderFrom)
+	if !ok || w.head || w.buffering || w.chunked || w.filter != nil {
+		// Hide ReadFrom so io.CopyBuffer does not call back into it.
+		return io.CopyBuffer(writerOnly{w}, src, make([]byte, copyBufferSize))
+	}
+	err = w.writer.Flush()
+	if err != nil {
+		return 0, err
+	}
+	n, err := rf.ReadFrom(src)
+	w.bodyBytesWritten += int(n)
+	return n, err
+}
+
+type writerOnly struct {
+	io.Writer
+}
+
+func (w *Writer) writeImplicitHead() error {
+	if w.writerState == writerStateStatusLine {
+		err := w.WriteStatusLine(StatusCodeOK)
+		if err != nil {
+			return err
+		}
+	}
+	if w.writerState == writerStateHeaders {
+		return w.WriteHeaders(w.Header())
+	}
+	return nil
+}
+
+// WriteContinue sends an interim "100 Continue" response and flushes it, telling
+// the client to go ahead and send the request body. Once the final status line
+// is written it is too late for an interim response, so nothing is sent and
+// the body is simply read as it arrives.
+func (w *Writer) WriteContinue() error {
+	if w.writerState != writerStateStatusLine {
+		return nil
+	}
+	_, err := w.writer.Write(getStatusLine(StatusCodeContinue, StatusText(StatusCodeContinue)))
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write([]byte("\r\n"))
+	if err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason writes the status line with a custom reason
+// phrase instead of the standard one.
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
 	if w.writerState != writerStateStatusLine {
 		return fmt.Errorf("unable to write status line in state %d", w.writerState)
 	}
+	err := validateStatus(statusCode, reason)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		w.writerState = writerStateHeaders
 	}()
 
-	_, err := w.writer.Write(getStatusLine(statusCode))
+	w.statusCode = statusCode
+	_, err = w.writer.Write(getStatusLine(statusCode, reason))
 	return err
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.writerState != writerStateHeaders {
 		return fmt.Errorf("unable to write headers in state %d", w.writerState)
 	}
@@ -48,13 +310,63 @@ func (w *Writer) WriteHeaders(h headers.Headers) error {
 		w.writerState = writerStateBody
 	}()
 
-	for k, v := range h {
-		_, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	if w.handlerHeader != nil && h != w.handlerHeader {
+		// Fields set through Header are sent too, unless h has its own.
+		own := h.Clone()
+		for name, value := range w.handlerHeader.All() {
+			if len(own.Values(name)) == 0 {
+				h.Add(name, value)
+			}
+		}
+	}
+	for _, fn := range w.onWriteHeaders {
+		fn(h)
+	}
+
+	if h.ContainsToken("Connection", "close") {
+		w.keepAlive = false
+	}
+	if h.ContainsToken("Transfer-Encoding", "chunked") {
+		w.chunked = true
+		if w.http10 {
+			h.Del("Transfer-Encoding")
+			w.keepAlive = false
+		}
+	} else if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n >= 0 {
+		w.contentLength = n
+	} else if bodyAllowed(w.statusCode) {
+		if w.bufferSize > 0 {
+			w.buffering = true
+			w.header = h
+			return nil
+		}
+		// The body can only be delimited by closing the connection.
+		w.keepAlive = false
+	}
+
+	return w.writeHeaders(h)
+}
+
+func (w *Writer) writeHeaders(h *headers.Headers) error {
+	_, err := h.WriteTo(w.writer)
+	if err != nil {
+		return err
+	}
+	if h.Get("Connection") == "" {
+		var err error
+		if !w.keepAlive {
+			_, err = w.writer.Write([]byte("Connection: close\r\n"))
+		} else if w.http10 {
+			_, err = w.writer.Write([]byte("Connection: keep-alive\r\n"))
+		}
 		if err != nil {
 			return err
 		}
 	}
-	_, err := w.writer.Write([]byte("\r\n"))
+	_, err = w.writer.Write([]byte("\r\n"))
 	return err
 }
 
@@ -62,13 +374,105 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, fmt.Errorf("unable to write body in state %d", w.writerState)
 	}
-	return w.writer.Write(p)
+	if w.filter != nil {
+		return w.filter.Write(p)
+	}
+	return w.writeBody(p)
+}
+
+func (w *Writer) writeBody(p []byte) (int, error) {
+	if !bodyAllowed(w.statusCode) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, ErrBodyNotAllowed
+	}
+	if w.head {
+		w.bodyBytesWritten += len(p)
+		return len(p), nil
+	}
+	if w.buffering {
+		if w.body.Len()+len(p) <= w.bufferSize {
+			w.body.Write(p)
+			w.bodyBytesWritten += len(p)
+			return len(p), nil
+		}
+		err := w.startChunked()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.chunked {
+		// Handlers asking for chunked encoding through Header or WriteHeaders
+		// write plain bytes with Write like everyone else.
+		if len(p) == 0 {
+			return 0, nil
+		}
+		_, err := w.writeChunk(p)
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	n, err := w.writer.Write(p)
+	w.bodyBytesWritten += n
+	return n, err
+}
+
+// startChunked gives up on buffering: the held back headers are sent with
+// chunked encoding and the buffered body becomes the first chunk. For HTTP/1.0
+// clients the body is sent as is and the connection closed after it.
+func (w *Writer) startChunked() error {
+	w.buffering = false
+	w.chunked = true
+	w.autoChunked = true
+	if w.http10 {
+		w.keepAlive = false
+	} else {
+		w.header.Overwrite("Transfer-Encoding", "chunked")
+	}
+	err := w.writeHeaders(w.header)
+	if err != nil {
+		return err
+	}
+	if w.body.Len() > 0 {
+		w.bodyBytesWritten -= w.body.Len()
+		_, err = w.writeChunk(w.body.Bytes())
+		w.body.Reset()
+	}
+	return err
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, fmt.Errorf("unable to write body in state %d", w.writerState)
 	}
+	if !bodyAllowed(w.statusCode) && len(p) > 0 {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.buffering {
+		err := w.startChunked()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.filter != nil {
+		return w.filter.Write(p)
+	}
+	return w.writeChunk(p)
+}
+
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if w.head {
+		w.bodyBytesWritten += len(p)
+		return 0, nil
+	}
+	if w.http10 {
+		n, err := w.writer.Write(p)
+		w.bodyBytesWritten += n
+		return n, err
+	}
 
 	totalBytes := 0
 
@@ -80,6 +484,7 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	totalBytes += n
 
 	n, err = w.writer.Write(p)
+	w.bodyBytesWritten += n
 	if err != nil {
 		return totalBytes, err
 	}
@@ -98,32 +503,138 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, fmt.Errorf("unable to write body in state %d", w.writerState)
 	}
-
-	n, err := w.writer.Write([]byte("0\r\n"))
+	err := w.closeFilter()
 	if err != nil {
-		return n, err
+		return 0, err
+	}
+	if w.buffering {
+		err := w.startChunked()
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	w.writerState = writerStateTrailers
-	return n, nil
+	if w.head || w.http10 {
+		return 0, nil
+	}
+	return w.writer.Write([]byte("0\r\n"))
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
 	if w.writerState != writerStateTrailers {
 		return fmt.Errorf("unable to write trailers in state %d", w.writerState)
 	}
+	if w.head || w.http10 {
+		// Trailers can only be sent with chunked encoding.
+		w.writerState = writerStateDone
+		return nil
+	}
+
+	_, err := h.WriteTo(w.writer)
+	if err != nil {
+		return err
+	}
 
-	for k, v := range h {
-		_, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
+	_, err = w.writer.Write([]byte("\r\n"))
+	if err != nil {
+		return err
+	}
+
+	w.writerState = writerStateDone
+	return nil
+}
+
+// Flush sends everything written so far to the client. A buffered body is
+// switched to chunked encoding first, since its length is not known yet.
+func (w *Writer) Flush() error {
+	if f, ok := w.filter.(interface{ Flush() error }); ok {
+		err := f.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	if w.buffering && !w.head {
+		err := w.startChunked()
 		if err != nil {
 			return err
 		}
 	}
+	return w.writer.Flush()
+}
+
+// Abort marks the response as broken, e.g. after a panic in the handler.
+// Nothing more is written, and Finish reports an error so the connection is
+// closed instead of sending an incomplete response as if it were whole.
+func (w *Writer) Abort() {
+	w.filter = nil
+	w.writerState = writerStateAborted
+	w.keepAlive = false
+}
 
-	_, err := w.writer.Write([]byte("\r\n"))
+// Finish completes whatever framing the handler left open, flushes the
+// response and decides whether the connection can be kept alive. The server
+// calls it after every handler.
+func (w *Writer) Finish() error {
+	err := w.finish()
 	if err != nil {
+		w.keepAlive = false
 		return err
 	}
+	err = w.writer.Flush()
+	if err != nil {
+		w.keepAlive = false
+	}
+	return err
+}
 
+func (w *Writer) finish() error {
+	switch w.writerState {
+	case writerStateAborted:
+		return errors.New("response was aborted")
+	case writerStateStatusLine, writerStateHeaders:
+		// The handler did not write a body; send the implicit head instead.
+		err := w.writeImplicitHead()
+		if err != nil {
+			return err
+		}
+		return w.finish()
+	case writerStateBody:
+		err := w.closeFilter()
+		if err != nil {
+			return err
+		}
+		if w.buffering {
+			w.buffering = false
+			w.contentLength = w.bodyBytesWritten
+			w.header.Overwrite("Content-Length", strconv.Itoa(w.contentLength))
+			err := w.writeHeaders(w.header)
+			if err != nil {
+				return err
+			}
+			_, err = w.writer.Write(w.body.Bytes())
+			if err != nil {
+				return err
+			}
+			w.body.Reset()
+		}
+		if w.chunked {
+			_, err := w.WriteChunkedBodyDone()
+			if err != nil {
+				return err
+			}
+			return w.finish()
+		}
+		if !w.head && w.contentLength >= 0 && w.bodyBytesWritten != w.contentLength {
+			w.keepAlive = false
+		}
+		w.writerState = writerStateDone
+	case writerStateTrailers:
+		return w.WriteTrailers(headers.NewHeaders())
+	}
 	return nil
 }
+
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
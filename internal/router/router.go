@@ -0,0 +1,269 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/server"
+)
+
+// MountPathValue is the path value holding the part of the path below a
+// Mount prefix or matched by a bare "*" wildcard.
+const MountPathValue = "*"
+
+type segmentKind int
+
+const (
+	segmentKindWildcard segmentKind = iota
+	segmentKindParam
+	segmentKindLiteral
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+type Router struct {
+	routes []route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for pattern, which is an optional method followed
+// by a path, e.g. "GET /users/{id}" or "/static/{path...}". A pattern without
+// a method matches every method. "{name}" matches one path segment and
+// "{name...}" or "*" matches the rest of the path. Handle panics on an invalid
+// or duplicate pattern.
+func (rt *Router) Handle(pattern string, handler server.Handler) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("router: pattern %q must start with a path beginning with /", pattern))
+	}
+
+	segments, err := parsePattern(path)
+	if err != nil {
+		panic(fmt.Sprintf("router: invalid pattern %q: %v", pattern, err))
+	}
+	for _, r := range rt.routes {
+		if r.method == method && sameShape(r.segments, segments) {
+			panic(fmt.Sprintf("router: pattern %q conflicts with %q", pattern, r.pattern))
+		}
+	}
+
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+// Mount registers handler for prefix and every path below it, for all
+// methods. The remainder of the path is available as PathValue("*").
+func (rt *Router) Mount(prefix string, handler server.Handler) {
+	rt.Handle(strings.TrimSuffix(prefix, "/")+"/*", handler)
+}
+
+// ServeHTTP dispatches req to the most specific matching route. HEAD requests
+// also match GET routes, OPTIONS requests without their own route are
+// answered with the allowed methods, and paths that only match other methods
+// get a 405.
+func (rt *Router) ServeHTTP(w *response.Writer, req *request.Request) {
+	// Split the raw path so an encoded "/" stays inside its segment.
+	pathSegments := strings.Split(strings.TrimPrefix(req.Target.RawPath, "/"), "/")
+	for i, seg := range pathSegments {
+		if decoded, err := url.PathUnescape(seg); err == nil {
+			pathSegments[i] = decoded
+		}
+	}
+
+	method := req.RequestLine.Method
+	best, values, allowed := rt.lookup(method, pathSegments)
+
+	if best == nil {
+		if len(allowed) == 0 {
+			writeError(w, response.StatusCodeNotFound, "")
+			return
+		}
+		if slices.Contains(allowed, "GET") && !slices.Contains(allowed, "HEAD") {
+			allowed = append(allowed, "HEAD")
+		}
+		if !slices.Contains(allowed, "OPTIONS") {
+			allowed = append(allowed, "OPTIONS")
+		}
+		slices.Sort(allowed)
+		if method == "OPTIONS" {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			w.WriteStatusLine(response.StatusCodeNoContent)
+			return
+		}
+		writeError(w, response.StatusCodeMethodNotAllowed, strings.Join(allowed, ", "))
+		return
+	}
+
+	for name, value := range values {
+		req.SetPathValue(name, value)
+	}
+	best.handler(w, req)
+}
+
+// lookup returns the most specific route for method and the path, or the
+// methods of the routes matching only the path. GET routes match HEAD requests
+// too, ranked like any other route.
+func (rt *Router) lookup(method string, pathSegments []string) (*route, map[string]string, []string) {
+	var best *route
+	var bestValues map[string]string
+	var allowed []string
+	for i := range rt.routes {
+		r := &rt.routes[i]
+		values, ok := r.match(pathSegments)
+		if !ok {
+			continue
+		}
+		if r.methodRank(method) < 0 {
+			if !slices.Contains(allowed, r.method) {
+				allowed = append(allowed, r.method)
+			}
+			continue
+		}
+		if best == nil || r.moreSpecificThan(best, method) {
+			best = r
+			bestValues = values
+		}
+	}
+	return best, bestValues, allowed
+}
+
+func parsePattern(path string) ([]segment, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch {
+		case part == "*":
+			if !last {
+				return nil, fmt.Errorf("wildcard must be the last segment")
+			}
+			segments = append(segments, segment{kind: segmentKindWildcard, value: MountPathValue})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			kind := segmentKindParam
+			if strings.HasSuffix(name, "...") {
+				if !last {
+					return nil, fmt.Errorf("wildcard must be the last segment")
+				}
+				name = strings.TrimSuffix(name, "...")
+				kind = segmentKindWildcard
+			}
+			if name == "" {
+				return nil, fmt.Errorf("empty parameter name")
+			}
+			segments = append(segments, segment{kind: kind, value: name})
+		case strings.ContainsAny(part, "{}"):
+			return nil, fmt.Errorf("parameters must span a whole segment")
+		default:
+			segments = append(segments, segment{kind: segmentKindLiteral, value: part})
+		}
+	}
+	return segments, nil
+}
+
+// sameShape reports whether two patterns match exactly the same paths.
+func sameShape(a, b []segment) bool {
+	return slices.EqualFunc(a, b, func(x, y segment) bool {
+		return x.kind == y.kind && (x.kind != segmentKindLiteral || x.value == y.value)
+	})
+}
+
+func (r *route) match(pathSegments []string) (map[string]string, bool) {
+	values := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.kind == segmentKindWildcard {
+			values[seg.value] = strings.Join(pathSegments[min(i, len(pathSegments)):], "/")
+			return values, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentKindLiteral:
+			if pathSegments[i] != seg.value {
+				return nil, false
+			}
+		case segmentKindParam:
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			values[seg.value] = pathSegments[i]
+		}
+	}
+	if len(pathSegments) != len(r.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+// methodRank tells how well the route's method fits a request method: -1 if
+// it does not match at all, 0 for routes without a method, 1 for a GET route
+// serving a HEAD request and 2 for the method itself.
+func (r *route) methodRank(method string) int {
+	switch {
+	case r.method == method:
+		return 2
+	case r.method == "GET" && method == "HEAD":
+		return 1
+	case r.method == "":
+		return 0
+	}
+	return -1
+}
+
+// moreSpecificThan compares segment by segment, preferring literals over
+// parameters over wildcards, then longer patterns, then the route whose method
+// fits the request method best.
+func (r *route) moreSpecificThan(other *route, method string) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind > other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.methodRank(method) > other.methodRank(method)
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, allow string) {
+	w.WriteStatusLine(statusCode)
+	var body []byte
+	switch statusCode {
+	case response.StatusCodeNotFound:
+		body = []byte("404 page not found\n")
+	case response.StatusCodeMethodNotAllowed:
+		body = []byte("405 method not allowed\n")
+	}
+	h := response.GetDefaultHeaders(len(body))
+	if allow != "" {
+		h.Set("Allow", allow)
+	}
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
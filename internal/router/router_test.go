@@ -0,0 +1,109 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, rt *Router, method, target string) string {
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequest(req)
+	rt.ServeHTTP(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func named(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := []byte(name + " id=" + req.PathValue("id") + " rest=" + req.PathValue("rest") + " *=" + req.PathValue("*"))
+		w.WriteStatusLine(response.StatusCodeOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Handle("GET /users/{id}", named("getUser"))
+	rt.Handle("DELETE /users/{id}", named("deleteUser"))
+	rt.Handle("GET /users/me", named("me"))
+	rt.Handle("/files/{rest...}", named("files"))
+	rt.Mount("/api", named("api"))
+
+	// Test: Path parameter
+	resp := serve(t, rt, "GET", "/users/42?verbose=1")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK")
+	assert.Contains(t, resp, "getUser id=42 ")
+
+	// Test: Method selects the route
+	resp = serve(t, rt, "DELETE", "/users/42")
+	assert.Contains(t, resp, "deleteUser id=42 ")
+
+	// Test: Parameters are decoded, encoded slashes stay in the segment
+	resp = serve(t, rt, "GET", "/users/a%2Fb%20c")
+	assert.Contains(t, resp, "getUser id=a/b c ")
+
+	// Test: Literal segment wins over parameter
+	resp = serve(t, rt, "GET", "/users/me")
+	assert.Contains(t, resp, "me id= ")
+
+	// Test: Named wildcard
+	resp = serve(t, rt, "POST", "/files/a/b/c.txt")
+	assert.Contains(t, resp, "files id= rest=a/b/c.txt ")
+
+	// Test: Prefix mount
+	resp = serve(t, rt, "PUT", "/api/v1/things")
+	assert.Contains(t, resp, "api id= rest= *=v1/things")
+	resp = serve(t, rt, "GET", "/api")
+	assert.Contains(t, resp, "api id= rest= *=")
+
+	// Test: Not found
+	resp = serve(t, rt, "GET", "/nope")
+	assert.Contains(t, resp, "HTTP/1.1 404 Not Found")
+
+	// Test: Method not allowed lists allowed methods
+	resp = serve(t, rt, "POST", "/users/42")
+	assert.Contains(t, resp, "HTTP/1.1 405 Method Not Allowed")
+	assert.Contains(t, resp, "Allow: DELETE, GET, HEAD, OPTIONS\r\n")
+
+	// Test: HEAD falls back to the GET route without a body
+	resp = serve(t, rt, "HEAD", "/users/42")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK")
+	assert.Contains(t, resp, "Content-Length: 22\r\n")
+	assert.NotContains(t, resp, "getUser")
+
+	// Test: HEAD prefers a matching GET route over a catch-all mount
+	mounted := New()
+	mounted.Mount("/", named("root"))
+	mounted.Handle("GET /upload", named("form"))
+	resp = serve(t, mounted, "HEAD", "/upload")
+	assert.Contains(t, resp, "Content-Length: 17\r\n")
+	resp = serve(t, mounted, "HEAD", "/other")
+	assert.Contains(t, resp, "Content-Length: 22\r\n")
+
+	// Test: Explicit HEAD route wins over GET at equal specificity
+	mounted.Handle("HEAD /upload", named("formHead"))
+	resp = serve(t, mounted, "HEAD", "/upload")
+	assert.Contains(t, resp, "Content-Length: 21\r\n")
+	resp = serve(t, mounted, "GET", "/upload")
+	assert.Contains(t, resp, "form id= ")
+
+	// Test: OPTIONS lists the allowed methods
+	resp = serve(t, rt, "OPTIONS", "/users/42")
+	assert.Contains(t, resp, "HTTP/1.1 204 No Content")
+	assert.Contains(t, resp, "Allow: DELETE, GET, HEAD, OPTIONS\r\n")
+
+	// Test: Invalid and duplicate patterns
+	assert.Panics(t, func() { rt.Handle("GET users", named("bad")) })
+	assert.Panics(t, func() { rt.Handle("GET /{rest...}/x", named("bad")) })
+	assert.Panics(t, func() { rt.Handle("GET /users/{name}", named("dup")) })
+}
@@ -1,10 +1,17 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
 	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
@@ -12,13 +19,68 @@ import (
 
 type Handler func(w *response.Writer, req *request.Request)
 
+type Options struct {
+	// ReadHeaderTimeout bounds reading the request line and headers, starting
+	// from the first byte of the request. Zero falls back to ReadTimeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request, body included.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response, starting once the request
+	// headers have been read.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection may wait for its next
+	// request. Zero falls back to ReadTimeout.
+	IdleTimeout time.Duration
+	// MaxRequestsPerConn caps the number of requests served on one
+	// connection. Zero means no limit.
+	MaxRequestsPerConn int
+	// ResponseBufferSize is how much of a response body without
+	// Content-Length is buffered to compute one before switching to chunked
+	// encoding. Zero uses response.DefaultBufferSize; negative disables
+	// buffering.
+	ResponseBufferSize int
+	// Limits bounds the size of incoming requests. Zero fields use
+	// request.DefaultLimits.
+	Limits request.Limits
+}
+
+const (
+	shutdownPollInterval = 50 * time.Millisecond
+	// newConnGracePeriod is how long Shutdown lets a connection that has not
+	// sent its first request yet get to it before closing it.
+	newConnGracePeriod   = 5 * time.Second
+	serverAllowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+)
+
+type connState int
+
+const (
+	connStateNew connState = iota
+	connStateIdle
+	connStateActive
+)
+
+type trackedConn struct {
+	state connState
+	since time.Time
+}
+
 type Server struct {
 	serverRunning atomic.Bool
+	inShutdown    atomic.Bool
 	handler       Handler
 	listener      net.Listener
+	options       Options
+
+	mu    sync.Mutex
+	conns map[net.Conn]trackedConn
 }
 
 func Serve(port int, handler Handler) (*Server, error) {
+	return ServeWithOptions(port, handler, Options{})
+}
+
+func ServeWithOptions(port int, handler Handler, options Options) (*Server, error) {
 	lsn, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create listener: %v", err)
@@ -27,7 +89,10 @@ func Serve(port int, handler Handler) (*Server, error) {
 	s := &Server{
 		handler:  handler,
 		listener: lsn,
+		options:  options,
+		conns:    map[net.Conn]trackedConn{},
 	}
+	s.serverRunning.Store(true)
 	go s.listen()
 	return s, nil
 }
@@ -40,6 +105,78 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Shutdown stops accepting connections, closes idle ones and waits for active
+// ones to finish their current response. Connections that have not sent a
+// request yet get a short grace period to do so. If ctx is done first, the
+// remaining connections are closed forcibly and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+	err := s.Close()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = trackedConn{state: connStateNew, since: time.Now()}
+}
+
+// setConnState reports false if the connection is no longer tracked because
+// Shutdown closed it.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[conn]; !ok {
+		return false
+	}
+	s.conns[conn] = trackedConn{state: state, since: time.Now()}
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// closeIdleConns reports whether no connections are left afterwards.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, c := range s.conns {
+		if c.state == connStateIdle || c.state == connStateNew && time.Since(c.since) > newConnGracePeriod {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) closeAllConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -51,22 +188,148 @@ func (s *Server) listen() {
 			log.Printf("unable to accept new connection: %v", err)
 			continue
 		}
+		s.trackConn(conn)
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	defer s.removeConn(conn)
 	defer conn.Close()
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(response.StatusCodeBadRequest)
-		b := fmt.Sprintf("unable to parse request: %v", err)
-		body := []byte(b)
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
-		return
+
+	// A panic in a handler only takes down its own connection. The client gets
+	// a 500 if nothing has been written yet, otherwise the connection is just
+	// closed since the response can no longer be completed.
+	var w *response.Writer
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		log.Printf("panic serving %v: %v\n%s", conn.RemoteAddr(), v, debug.Stack())
+		if w != nil && w.StatusCode() == 0 {
+			// A fresh Writer, so nothing the handler set up ends up in the 500.
+			writeError(response.NewWriter(conn), response.StatusCodeInternalServerError, "internal server error")
+		}
+	}()
+
+	reader := request.NewReader(conn)
+	reader.Limits = s.options.Limits
+	for numRequests := 1; ; numRequests++ {
+		waitTimeout := s.options.IdleTimeout
+		if numRequests == 1 {
+			waitTimeout = s.options.ReadHeaderTimeout
+		}
+		if waitTimeout == 0 {
+			waitTimeout = s.options.ReadTimeout
+		}
+		if numRequests > 1 {
+			if !s.setConnState(conn, connStateIdle) || s.inShutdown.Load() {
+				return
+			}
+		}
+		conn.SetReadDeadline(deadline(time.Now(), waitTimeout))
+		err := reader.WaitForRequest()
+		if err != nil {
+			// The client went away, stayed idle for too long or the connection
+			// was closed by Shutdown; there is no request to answer.
+			return
+		}
+		if !s.setConnState(conn, connStateActive) {
+			return
+		}
+
+		start := time.Now()
+		headerTimeout := s.options.ReadHeaderTimeout
+		if headerTimeout == 0 {
+			headerTimeout = s.options.ReadTimeout
+		}
+		conn.SetReadDeadline(deadline(start, headerTimeout))
+		req, err := reader.ReadRequest()
+		conn.SetWriteDeadline(deadline(time.Now(), s.options.WriteTimeout))
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			writeError(response.NewWriter(conn), requestErrorStatusCode(err), fmt.Sprintf("unable to parse request: %v", err))
+			return
+		}
+		conn.SetReadDeadline(deadline(start, s.options.ReadTimeout))
+
+		w = response.NewWriter(conn)
+		w.SetRequest(req)
+		req.SetContinueFunc(w.WriteContinue)
+		if s.options.ResponseBufferSize != 0 {
+			w.SetBufferSize(s.options.ResponseBufferSize)
+		}
+		maxReached := s.options.MaxRequestsPerConn > 0 && numRequests >= s.options.MaxRequestsPerConn
+		w.SetKeepAlive(req.KeepAlive() && !maxReached && !s.inShutdown.Load())
+		if req.RequestLine.Method == "OPTIONS" && req.RequestLine.RequestTarget == "*" {
+			// "OPTIONS *" asks about the server as a whole rather than a resource.
+			w.Header().Set("Allow", serverAllowedMethods)
+			w.WriteStatusLine(response.StatusCodeNoContent)
+		} else {
+			s.serve(w, req)
+		}
+		if w.StatusCode() == 0 && errors.Is(req.BodyErr(), request.ErrBodyTooLarge) {
+			// The handler gave up on a chunked body over the limit without
+			// answering; the client still deserves to know why.
+			writeError(response.NewWriter(conn), response.StatusCodeContentTooLarge, "request body too large")
+			return
+		}
+		if req.ContinuePending() {
+			// The client never got to send the body. Closing is cheaper than
+			// asking for it only to throw it away.
+			w.SetKeepAlive(false)
+		}
+		if err := w.Finish(); err != nil || !w.KeepAlive() {
+			return
+		}
+		if err := req.DiscardBody(); err != nil {
+			return
+		}
 	}
+}
+
+func (s *Server) serve(w *response.Writer, req *request.Request) {
+	// Temporary files from ParseMultipartForm only live as long as the handler.
+	defer req.RemoveFormFiles()
 	s.handler(w, req)
-	return
+}
+
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func requestErrorStatusCode(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return response.StatusCodeRequestTimeout
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusCodeURITooLong
+	case errors.Is(err, request.ErrHeadersTooLarge):
+		return response.StatusCodeRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusCodeContentTooLarge
+	case errors.Is(err, request.ErrExpectationFailed):
+		return response.StatusCodeExpectationFailed
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding):
+		return response.StatusCodeNotImplemented
+	case errors.Is(err, request.ErrVersionNotSupported):
+		return response.StatusCodeHTTPVersionNotSupported
+	default:
+		return response.StatusCodeBadRequest
+	}
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.SetKeepAlive(false)
+	w.WriteStatusLine(statusCode)
+	body := []byte(message)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+	w.Finish()
 }
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/headers"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler Handler, options Options) (*Server, string) {
+	s, err := ServeWithOptions(0, handler, options)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, s.listener.Addr().String()
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	// Keep a broken test from hanging forever.
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, raw string) (*http.Response, string) {
+	_, err := io.WriteString(conn, raw)
+	require.NoError(t, err)
+	return readResponse(t, r)
+}
+
+func readResponse(t *testing.T, r *bufio.Reader) (*http.Response, string) {
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp, string(body)
+}
+
+// assertClosed checks that the server closed the connection without sending
+// anything more.
+func assertClosed(t *testing.T, r *bufio.Reader) {
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, string(rest))
+}
+
+func ok(w *response.Writer, req *request.Request) {
+	w.Write([]byte("ok"))
+}
+
+const getRequest = "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+
+func TestKeepAlive(t *testing.T) {
+	// Test: Several requests are served on one connection
+	_, addr := startServer(t, ok, Options{})
+	conn, r := dial(t, addr)
+	for range 3 {
+		resp, body := roundTrip(t, conn, r, getRequest)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "ok", body)
+		assert.False(t, resp.Close)
+	}
+
+	// Test: Connection: close from the client ends the connection
+	resp, _ := roundTrip(t, conn, r, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.True(t, resp.Close)
+	assertClosed(t, r)
+
+	// Test: Connection is closed after MaxRequestsPerConn requests
+	_, addr = startServer(t, ok, Options{MaxRequestsPerConn: 2})
+	conn, r = dial(t, addr)
+	resp, _ = roundTrip(t, conn, r, getRequest)
+	assert.False(t, resp.Close)
+	resp, _ = roundTrip(t, conn, r, getRequest)
+	assert.True(t, resp.Close)
+	assertClosed(t, r)
+}
+
+func TestTimeouts(t *testing.T) {
+	_, addr := startServer(t, ok, Options{
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		IdleTimeout:       100 * time.Millisecond,
+	})
+
+	// Test: Headers arriving too slowly get a 408
+	conn, r := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	resp, _ := readResponse(t, r)
+	assert.Equal(t, 408, resp.StatusCode)
+	assert.True(t, resp.Close)
+	assertClosed(t, r)
+
+	// Test: Connection without any request is closed silently
+	_, r = dial(t, addr)
+	assertClosed(t, r)
+
+	// Test: Idle keep-alive connection is closed
+	conn, r = dial(t, addr)
+	resp, _ = roundTrip(t, conn, r, getRequest)
+	assert.Equal(t, 200, resp.StatusCode)
+	start := time.Now()
+	assertClosed(t, r)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}
+
+	// Test: Shutdown waits for active requests and closes idle connections
+	s, addr := startServer(t, blocking, Options{})
+	idleConn, idleReader := dial(t, addr)
+	roundTrip(t, idleConn, idleReader, getRequest)
+	conn, r := dial(t, addr)
+	_, err := io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+	done := make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	assertClosed(t, idleReader)
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the active request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	resp, body := readResponse(t, r)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+	assertClosed(t, r)
+	require.NoError(t, <-done)
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+
+	// Test: Connection accepted before Shutdown still gets its request served
+	s, addr = startServer(t, blocking, Options{})
+	conn, r = dial(t, addr)
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	}, time.Second, 10*time.Millisecond)
+	done = make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	time.Sleep(2 * shutdownPollInterval)
+	resp, body = roundTrip(t, conn, r, getRequest)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+	assert.True(t, resp.Close)
+	require.NoError(t, <-done)
+
+	// Test: Connections still active when ctx ends are closed forcibly
+	release = make(chan struct{})
+	defer close(release)
+	s, addr = startServer(t, blocking, Options{})
+	conn, r = dial(t, addr)
+	_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assertClosed(t, r)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/before":
+			w.Header().Set("Set-Cookie", "session=abc")
+			w.OnWriteHeaders(func(h *headers.Headers) { h.Set("X-Hook", "1") })
+			panic("boom")
+		case "/after":
+			w.WriteStatusLine(response.StatusCodeOK)
+			w.Write([]byte("partial"))
+			w.Flush()
+			panic("boom")
+		}
+		w.Write([]byte("ok"))
+	}, Options{})
+
+	// Test: Panic before writing sends a 500 and closes the connection
+	conn, r := dial(t, addr)
+	resp, _ := roundTrip(t, conn, r, "GET /before HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.True(t, resp.Close)
+	assert.Empty(t, resp.Header.Get("Set-Cookie"))
+	assert.Empty(t, resp.Header.Get("X-Hook"))
+	assertClosed(t, r)
+
+	// Test: Panic after writing closes the connection mid-response
+	conn, r = dial(t, addr)
+	_, err := io.WriteString(conn, "GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	partial, err := io.ReadAll(resp.Body)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "partial", string(partial))
+
+	// Test: Server keeps serving other connections
+	conn, r = dial(t, addr)
+	resp, body := roundTrip(t, conn, r, getRequest)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "ok", body)
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/ignore" {
+			io.ReadAll(req.BodyReader)
+			return
+		}
+		_, err := io.ReadAll(req.BodyReader)
+		w.Write([]byte(fmt.Sprintf("err=%v", err)))
+	}, Options{Limits: request.Limits{MaxBodyBytes: 8}})
+	chunked := "Host: localhost\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n"
+
+	// Test: Chunked body over the limit gets a 413 if the handler did not answer
+	conn, r := dial(t, addr)
+	resp, _ := roundTrip(t, conn, r, "POST /ignore HTTP/1.1\r\n"+chunked)
+	assert.Equal(t, 413, resp.StatusCode)
+	assert.True(t, resp.Close)
+	assertClosed(t, r)
+
+	// Test: Handler's own response is kept
+	conn, r = dial(t, addr)
+	resp, body := roundTrip(t, conn, r, "POST / HTTP/1.1\r\n"+chunked)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, body, "request body too large")
+
+	// Test: Content-Length over the limit is refused before the handler runs
+	conn, r = dial(t, addr)
+	resp, _ = roundTrip(t, conn, r, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 9\r\n\r\n123456789")
+	assert.Equal(t, 413, resp.StatusCode)
+}
+
+func TestExpectContinue(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/status-first" {
+			w.WriteStatusLine(response.StatusCodeOK)
+		}
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			body = []byte(err.Error())
+		}
+		w.Write(body)
+	}, Options{})
+	expect := "Host: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"
+
+	// Test: 100 Continue is sent when the handler reads the body
+	conn, r := dial(t, addr)
+	_, err := io.WriteString(conn, "PUT / HTTP/1.1\r\n"+expect)
+	require.NoError(t, err)
+	resp, _ := readResponse(t, r)
+	assert.Equal(t, 100, resp.StatusCode)
+	resp, body := roundTrip(t, conn, r, "hello")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "hello", body)
+
+	// Test: Body can still be read after the final status line is written
+	conn, r = dial(t, addr)
+	_, err = io.WriteString(conn, "PUT /status-first HTTP/1.1\r\n"+expect)
+	require.NoError(t, err)
+	// Like curl, send the body anyway after waiting a while for the 100.
+	time.Sleep(100 * time.Millisecond)
+	resp, body = roundTrip(t, conn, r, "hello")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "hello", body)
+}
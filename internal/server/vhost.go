@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+)
+
+// VirtualHosts is a Handler that picks another handler by the host a request
+// is addressed to, so one Server can serve several sites.
+type VirtualHosts struct {
+	hosts    map[string]Handler
+	fallback Handler
+}
+
+// NewVirtualHosts returns a VirtualHosts that sends requests for unknown hosts
+// to fallback. With a nil fallback they get a 421 Misdirected Request.
+func NewVirtualHosts(fallback Handler) *VirtualHosts {
+	return &VirtualHosts{
+		hosts:    map[string]Handler{},
+		fallback: fallback,
+	}
+}
+
+// Handle registers handler for host. Hosts are matched case-insensitively. A
+// host with a port only matches requests for that port; one without a port
+// matches any port.
+func (v *VirtualHosts) Handle(host string, handler Handler) {
+	name, port := splitHost(host)
+	if port != "" {
+		name = net.JoinHostPort(name, port)
+	}
+	v.hosts[name] = handler
+}
+
+func (v *VirtualHosts) ServeHTTP(w *response.Writer, req *request.Request) {
+	v.handler(req.Host())(w, req)
+}
+
+func (v *VirtualHosts) handler(host string) Handler {
+	name, port := splitHost(host)
+	if port != "" {
+		if h, ok := v.hosts[net.JoinHostPort(name, port)]; ok {
+			return h
+		}
+	}
+	if h, ok := v.hosts[name]; ok {
+		return h
+	}
+	if v.fallback != nil {
+		return v.fallback
+	}
+	return misdirected
+}
+
+func splitHost(host string) (name, port string) {
+	host = strings.ToLower(host)
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = strings.Trim(host, "[]"), ""
+	}
+	return strings.TrimSuffix(name, "."), port
+}
+
+func misdirected(w *response.Writer, req *request.Request) {
+	body := []byte("421 misdirected request\n")
+	w.WriteStatusLine(response.StatusCodeMisdirectedRequest)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
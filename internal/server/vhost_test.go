@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mogumogu934/learnhttpfromtcp/internal/request"
+	"github.com/mogumogu934/learnhttpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveHost(t *testing.T, v *VirtualHosts, target, host string) string {
+	req, err := request.RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: " + host + "\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	v.ServeHTTP(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func site(name string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.Write([]byte(name))
+	}
+}
+
+func TestVirtualHosts(t *testing.T) {
+	v := NewVirtualHosts(site("default"))
+	v.Handle("Wiki.Example.com", site("wiki"))
+	v.Handle("status.example.com:8080", site("status-8080"))
+	v.Handle("status.example.com", site("status"))
+
+	// Test: Host is case-insensitive and the port is ignored
+	resp := serveHost(t, v, "/", "wiki.example.COM:42069")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nwiki"), resp)
+
+	// Test: Host with port wins over host without
+	resp = serveHost(t, v, "/", "status.example.com:8080")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nstatus-8080"), resp)
+	resp = serveHost(t, v, "/", "status.example.com:9090")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nstatus"), resp)
+
+	// Test: Absolute-form target overrides Host header
+	resp = serveHost(t, v, "http://wiki.example.com/", "status.example.com")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nwiki"), resp)
+
+	// Test: Unknown host uses the fallback
+	resp = serveHost(t, v, "/", "localhost:42069")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\ndefault"), resp)
+
+	// Test: Unknown host without a fallback
+	v = NewVirtualHosts(nil)
+	resp = serveHost(t, v, "/", "localhost:42069")
+	assert.Contains(t, resp, "HTTP/1.1 421 Misdirected Request")
+}